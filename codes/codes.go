@@ -0,0 +1,138 @@
+// Parses and validates Monash unit codes.
+// Codes are a three or four letter faculty prefix, a level digit and a three digit sequence,
+// e.g. FIT1008 (FIT, level 1, 008) or DPSY5101 (DPSY, level 5, 101).
+
+package codes
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	unitCodePattern   = regexp.MustCompile(`^([A-Z]{3,4})([0-9])([0-9]{3})$`)
+	unitSearchPattern = regexp.MustCompile(`[A-Z]{3,4}[0-9]{4}`)
+)
+
+type UnitCode struct {
+	Code     string `json:"code"`
+	Prefix   string `json:"prefix"`
+	Level    int    `json:"level"`
+	Sequence string `json:"sequence"`
+}
+
+// Normalise trims whitespace (the index contains entries such as "ACM2130\t\t") and upper-cases a code.
+func Normalise(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Parse splits a unit code into its faculty prefix, level and sequence.
+func Parse(code string) (UnitCode, error) {
+	normalised := Normalise(code)
+	match := unitCodePattern.FindStringSubmatch(normalised)
+	if match == nil {
+		return UnitCode{}, fmt.Errorf("%q is not a unit code", code)
+	}
+	level, _ := strconv.Atoi(match[2])
+	return UnitCode{
+		Code:     normalised,
+		Prefix:   match[1],
+		Level:    level,
+		Sequence: match[3],
+	}, nil
+}
+
+// IsUnitCode reports whether a string is shaped like a unit code.
+func IsUnitCode(code string) bool {
+	return unitCodePattern.MatchString(Normalise(code))
+}
+
+// Level returns the unit level of a code, or 0 if it cannot be parsed.
+func Level(code string) int {
+	parsed, err := Parse(code)
+	if err != nil {
+		return 0
+	}
+	return parsed.Level
+}
+
+// Extract finds every unit-shaped code in free text, in order of appearance.
+// A four letter prefix is a code of its own, so "XFIT1008" is taken as XFIT1008. Matches that
+// run into a further letter or digit (e.g. "ABFIT1008", "2FIT1008" or "FIT10081") are ignored.
+func Extract(text string) []string {
+	found := make([]string, 0)
+	for _, loc := range unitSearchPattern.FindAllStringIndex(text, -1) {
+		start, end := loc[0], loc[1]
+		if start > 0 && isUpperOrDigit(text[start-1]) {
+			continue
+		}
+		if end < len(text) && isDigit(text[end]) {
+			continue
+		}
+		found = append(found, text[start:end])
+	}
+	return found
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isUpperOrDigit(c byte) bool {
+	return isDigit(c) || (c >= 'A' && c <= 'Z')
+}
+
+// Index is the set of unit codes published in the CourseLoop index.
+type Index struct {
+	known map[string]bool
+}
+
+func NewIndex(unitCodes []string) *Index {
+	index := &Index{known: make(map[string]bool, len(unitCodes))}
+	for _, code := range unitCodes {
+		index.known[Normalise(code)] = true
+	}
+	return index
+}
+
+// Contains reports whether a code is in the index. A nil index accepts every well formed code.
+func (index *Index) Contains(code string) bool {
+	if index == nil {
+		return IsUnitCode(code)
+	}
+	return index.known[Normalise(code)]
+}
+
+// Extract splits the codes found in text into those present in the index and those that are not.
+func (index *Index) Extract(text string) ([]string, []string) {
+	known := make([]string, 0)
+	unknown := make([]string, 0)
+	for _, code := range Extract(text) {
+		if index.Contains(code) {
+			known = append(known, code)
+		} else {
+			unknown = append(unknown, code)
+		}
+	}
+	return known, unknown
+}
+
+// UnknownCodes records codes found in an item's rule text that are not in the index.
+type UnknownCodes struct {
+	Item  string   `json:"item"`
+	Codes []string `json:"codes"`
+	Text  string   `json:"text"`
+}
+
+// SortUnknown orders a report by item then text so reruns produce stable files.
+func SortUnknown(report []UnknownCodes) {
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Item != report[j].Item {
+			return report[i].Item < report[j].Item
+		}
+		return report[i].Text < report[j].Text
+	})
+}
@@ -0,0 +1,95 @@
+package codes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		code string
+		want UnitCode
+		err  bool
+	}{
+		{code: "FIT1008", want: UnitCode{Code: "FIT1008", Prefix: "FIT", Level: 1, Sequence: "008"}},
+		{code: "DPSY5101", want: UnitCode{Code: "DPSY5101", Prefix: "DPSY", Level: 5, Sequence: "101"}},
+		{code: " acm2130\t\t", want: UnitCode{Code: "ACM2130", Prefix: "ACM", Level: 2, Sequence: "130"}},
+		{code: "FI1008", err: true},
+		{code: "ABCDE1008", err: true},
+		{code: "FIT10081", err: true},
+		{code: "C2001", err: true},
+		{code: "", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.code, func(t *testing.T) {
+			got, err := Parse(test.code)
+			if (err != nil) != test.err {
+				t.Fatalf("err = %v, want error %v", err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsUnitCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"FIT1008", true},
+		{"DPSY5101", true},
+		{"fit1008", true},
+		{"FIT100", false},
+		{"FIT1008A", false},
+		{"C2001", false},
+		{"SFTWRENG01", false},
+	}
+
+	for _, test := range tests {
+		if got := IsUnitCode(test.code); got != test.want {
+			t.Errorf("IsUnitCode(%q) = %v, want %v", test.code, got, test.want)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"in order of appearance", "Prerequisite: MAT1830 and FIT1008 or FIT1054", []string{"MAT1830", "FIT1008", "FIT1054"}},
+		{"four letter prefix", "Prohibition: DPSY5101", []string{"DPSY5101"}},
+		{"four letters run together", "XFIT1008", []string{"XFIT1008"}},
+		{"five letters run together", "ABFIT1008", []string{}},
+		{"preceded by a digit", "2FIT1008", []string{}},
+		{"followed by a digit", "FIT10081", []string{}},
+		{"punctuation around codes", "(FIT1008/FIT1054),MAT1830.", []string{"FIT1008", "FIT1054", "MAT1830"}},
+		{"lower case is not a code", "fit1008", []string{}},
+		{"no codes", "Permission required", []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Extract(test.text); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Extract(%q) = %v, want %v", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestIndexExtract(t *testing.T) {
+	index := NewIndex([]string{"FIT1008", "ACM2130\t\t"})
+	known, unknown := index.Extract("FIT1008, ACM2130 or FIT9999")
+	if !reflect.DeepEqual(known, []string{"FIT1008", "ACM2130"}) || !reflect.DeepEqual(unknown, []string{"FIT9999"}) {
+		t.Errorf("known %v, unknown %v", known, unknown)
+	}
+
+	var none *Index
+	if !none.Contains("FIT9999") || none.Contains("C2001") {
+		t.Error("a nil index should accept every well formed code and nothing else")
+	}
+}
@@ -0,0 +1,65 @@
+package codes
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Helpers for the numbers, lists and sets of codes the format and process packages pass around.
+
+// NumberWords maps the counts handbook and MonPlan text spells out, as in "two units from".
+var NumberWords = map[string]int{
+	"one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+}
+
+// ParseInt reads a whole number from a decoded JSON value, which the handbook gives as
+// either a number or a numeric string. Anything else is 0.
+func ParseInt(value interface{}) int {
+	switch v := value.(type) {
+	case float64:
+		return int(v)
+	case string:
+		if number, err := strconv.Atoi(v); err == nil {
+			return number
+		}
+	}
+	return 0
+}
+
+// Sorted returns the members of a set in order.
+func Sorted(set map[string]bool) []string {
+	items := make([]string, 0, len(set))
+	for item := range set {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+	return items
+}
+
+// SortedKeys returns the codes a collection is keyed by, in order.
+func SortedKeys(collection map[string]interface{}) []string {
+	keys := make([]string, 0, len(collection))
+	for key := range collection {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// UniqueSorted drops repeated items and sorts the rest. An empty list gives nil.
+func UniqueSorted(items []string) []string {
+	if len(items) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	unique := make([]string, 0, len(items))
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			unique = append(unique, item)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
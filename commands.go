@@ -0,0 +1,776 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"handbook-scraper/codes"
+	"handbook-scraper/config"
+	"handbook-scraper/format"
+	"handbook-scraper/graph"
+	"handbook-scraper/pipeline"
+	"handbook-scraper/process"
+	"handbook-scraper/scrape"
+	"handbook-scraper/storage"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Only scrape, requisites, run and validate --monplan reach the network.
+// Everything else works from the artefacts in the data directory.
+
+func setupScrape(fs *flag.FlagSet) func(*config.Config, storage.Store, string) error {
+	return func(settings *config.Config, store storage.Store, content string) error {
+		return scrapeContent(settings, store, content, true)
+	}
+}
+
+func setupFormat(fs *flag.FlagSet) func(*config.Config, storage.Store, string) error {
+	return func(settings *config.Config, store storage.Store, content string) error {
+		return formatContent(settings, store, content)
+	}
+}
+
+func setupRequisites(fs *flag.FlagSet) func(*config.Config, storage.Store, string) error {
+	return func(settings *config.Config, store storage.Store, _ string) error {
+		return scrapeRequisites(settings, store)
+	}
+}
+
+func setupProcess(fs *flag.FlagSet) func(*config.Config, storage.Store, string) error {
+	allFlag := fs.Bool("all", false, "also join courses and areas of study into catalog.json")
+	return func(settings *config.Config, store storage.Store, _ string) error {
+		return processUnits(store, *allFlag)
+	}
+}
+
+func setupRun(fs *flag.FlagSet) func(*config.Config, storage.Store, string) error {
+	forceFlag := fs.Bool("force", false, "run every stage even when its outputs are up to date")
+	return func(settings *config.Config, store storage.Store, _ string) error {
+		return pipeline.Run(pipelineStages(settings, store), pipeline.Options{
+			Force: *forceFlag,
+			Store: store,
+			// An incomplete scrape still feeds the later stages, and is resumed next run
+			Partial: func(err error) bool { return errors.Is(err, scrape.ErrIncomplete) },
+		})
+	}
+}
+
+// pipelineStages declares the whole pipeline with the artefacts each stage reads and writes.
+func pipelineStages(settings *config.Config, store storage.Store) []pipeline.Stage {
+	scrapeStage := func(content string, after ...string) pipeline.Stage {
+		return pipeline.Stage{
+			Name:    "scrape-" + content,
+			Inputs:  []storage.Key{storage.ContentSplits},
+			Outputs: []storage.Key{storage.Raw(content)},
+			After:   after,
+			// A resumed scrape only retries the items that failed
+			Run: func(resume bool) error { return scrapeContent(settings, store, content, !resume) },
+		}
+	}
+	formatStage := func(content string, inputs []storage.Key, outputs []storage.Key) pipeline.Stage {
+		return pipeline.Stage{
+			Name:    "format-" + content,
+			Inputs:  append([]storage.Key{storage.Raw(content)}, inputs...),
+			Outputs: append([]storage.Key{storage.Formatted(content)}, outputs...),
+			Run:     func(bool) error { return formatContent(settings, store, content) },
+		}
+	}
+
+	return []pipeline.Stage{
+		{
+			Name:    "index",
+			Outputs: []storage.Key{storage.ContentSplits},
+			Run: func(bool) error {
+				_, err := loadContentSplits(settings, store)
+				return err
+			},
+		},
+		// Units wait for the smaller scrapes so at most two hit the rate limited handbook at once
+		scrapeStage("units", "scrape-courses", "scrape-aos"),
+		scrapeStage("courses"),
+		scrapeStage("aos"),
+		formatStage("units",
+			[]storage.Key{storage.ContentSplits},
+			[]storage.Key{storage.DetectedYear, storage.ProhibitionCandidates, storage.EquivalentUnitGroups}),
+		formatStage("aos",
+			[]storage.Key{storage.Formatted("units")},
+			[]storage.Key{storage.RequirementIssues("aos")}),
+		formatStage("courses",
+			[]storage.Key{storage.Formatted("units"), storage.Formatted("aos")},
+			[]storage.Key{storage.RequirementIssues("courses")}),
+		{
+			Name:    "requisites",
+			Inputs:  []storage.Key{storage.ContentSplits, storage.DetectedYear, storage.EquivalentUnitGroups},
+			Outputs: []storage.Key{storage.Raw("prerequisites"), storage.Raw("prohibitions")},
+			Run:     func(bool) error { return scrapeRequisites(settings, store) },
+		},
+		{
+			Name:    "process",
+			Inputs:  []storage.Key{storage.Formatted("units"), storage.Raw("prerequisites"), storage.Raw("prohibitions"), storage.Formatted("courses"), storage.Formatted("aos")},
+			Outputs: []storage.Key{storage.ProcessedUnits, storage.Catalog},
+			Run:     func(bool) error { return processUnits(store, true) },
+		},
+	}
+}
+
+func setupProgress(fs *flag.FlagSet) func(*config.Config, storage.Store, string) error {
+	courseFlag := fs.String("course", "", "course code to check progression against (required)")
+	unitsFlag := fs.String("units", "", "comma separated list of completed unit codes")
+	jsonFlag := fs.Bool("json", false, "print the report as JSON")
+	return func(settings *config.Config, store storage.Store, _ string) error {
+		if *courseFlag == "" {
+			return usagef("progress needs --course")
+		}
+		courses, err := loadFormatted(store, "courses")
+		if err != nil {
+			return err
+		}
+		units, err := loadFormatted(store, "units")
+		if err != nil {
+			return err
+		}
+		aos, err := loadFormatted(store, "aos")
+		if err != nil {
+			return err
+		}
+		report, err := process.CheckProgression(*courseFlag, splitUnits(*unitsFlag), courses, units, aos)
+		if err != nil {
+			return fmt.Errorf("checking progression: %w", err)
+		}
+
+		if *jsonFlag {
+			return printJSON(report)
+		}
+		fmt.Print(process.FormatProgression(report))
+		return nil
+	}
+}
+
+func setupUnlocks(fs *flag.FlagSet) func(*config.Config, storage.Store, string) error {
+	unitsFlag := fs.String("units", "", "comma separated list of completed unit codes")
+	courseFlag := fs.String("course", "", "course code to check enrolment restrictions against")
+	jsonFlag := fs.Bool("json", false, "print the report as JSON")
+	return func(settings *config.Config, store storage.Store, _ string) error {
+		units, err := loadProcessedUnits(store)
+		if err != nil {
+			return fmt.Errorf("loading processed units: %w", err)
+		}
+
+		report := process.Unlocked(units, splitUnits(*unitsFlag), *courseFlag)
+		if *jsonFlag {
+			return printJSON(report)
+		}
+		fmt.Printf("Directly unlocked (%d): %s\n", len(report.Direct), strings.Join(report.Direct, ", "))
+		fmt.Printf("Transitively unlocked (%d): %s\n", len(report.Transitive), strings.Join(report.Transitive, ", "))
+		return nil
+	}
+}
+
+func setupEligible(fs *flag.FlagSet) func(*config.Config, storage.Store, string) error {
+	unitsFlag := fs.String("units", "", "comma separated list of completed unit codes")
+	enrolledFlag := fs.String("enrolled", "", "comma separated list of currently enrolled unit codes")
+	creditPointsFlag := fs.Int("credit-points", 0, "total credit points earned (default: sum of --units)")
+	courseFlag := fs.String("course", "", "course code to check enrolment restrictions against")
+	unitFlag := fs.String("unit", "", "only explain this unit")
+	jsonFlag := fs.Bool("json", false, "print the report as JSON")
+	return func(settings *config.Config, store storage.Store, _ string) error {
+		if *creditPointsFlag < 0 {
+			return usagef("--credit-points must not be negative")
+		}
+		units, err := loadProcessedUnits(store)
+		if err != nil {
+			return fmt.Errorf("loading processed units: %w", err)
+		}
+
+		query := process.EligibilityQuery{
+			Completed:    splitUnits(*unitsFlag),
+			Enrolled:     splitUnits(*enrolledFlag),
+			CreditPoints: *creditPointsFlag,
+			Course:       *courseFlag,
+		}
+
+		// With --unit only that unit is explained
+		if *unitFlag != "" {
+			unitResult := process.NewEligibilityChecker(units, query).Check(codes.Normalise(*unitFlag))
+			if *jsonFlag {
+				return printJSON(unitResult)
+			}
+			if unitResult.Eligible {
+				fmt.Printf("%s: eligible\n", unitResult.Unit)
+			} else {
+				fmt.Printf("%s: not eligible\n", unitResult.Unit)
+			}
+			if unitResult.RequiresPermission {
+				fmt.Println("  requires permission")
+			}
+			for _, clause := range unitResult.Unmet {
+				fmt.Printf("  unmet %s: %s\n", clause.Kind, clause.Clause)
+			}
+			return nil
+		}
+
+		report := process.CheckEligibility(units, query)
+		if *jsonFlag {
+			return printJSON(report)
+		}
+		fmt.Printf("Eligible (%d): %s\n", len(report.Eligible), strings.Join(report.Eligible, ", "))
+		fmt.Printf("Ineligible: %d units (use --unit or --json for the unmet clauses)\n", len(report.Ineligible))
+		return nil
+	}
+}
+
+func setupPlan(fs *flag.FlagSet) func(*config.Config, storage.Store, string) error {
+	courseFlag := fs.String("course", "", "course code to check enrolment restrictions against")
+	unitsFlag := fs.String("units", "", "comma separated list of completed unit codes")
+	desiredFlag := fs.String("desired", "", "comma separated list of unit codes to plan (required)")
+	creditPointsFlag := fs.Int("credit-points", 0, "total credit points earned (default: sum of --units)")
+	loadFlag := fs.Int("load", process.DefaultSemesterLoad, "credit points per semester")
+	semestersFlag := fs.Int("semesters", process.DefaultMaxSemesters, "maximum number of semesters to plan")
+	startFlag := fs.String("start", "S1", "semester the plan starts in: S1 or S2")
+	jsonFlag := fs.Bool("json", false, "print the plan as JSON")
+	return func(settings *config.Config, store storage.Store, _ string) error {
+		desired := splitUnits(*desiredFlag)
+		var start string
+		switch {
+		case len(desired) == 0:
+			return usagef("plan needs --desired")
+		case *loadFlag < 1:
+			return usagef("--load must be at least 1")
+		case *semestersFlag < 1:
+			return usagef("--semesters must be at least 1")
+		case strings.EqualFold(*startFlag, "S1"):
+			start = process.PeriodFirstSemester
+		case strings.EqualFold(*startFlag, "S2"):
+			start = process.PeriodSecondSemester
+		default:
+			return usagef("--start must be S1 or S2, got %q", *startFlag)
+		}
+
+		units, err := loadProcessedUnits(store)
+		if err != nil {
+			return fmt.Errorf("loading processed units: %w", err)
+		}
+
+		plan := process.PlanStudy(units, process.PlanRequest{
+			Course:       *courseFlag,
+			Completed:    splitUnits(*unitsFlag),
+			Desired:      desired,
+			Load:         *loadFlag,
+			CreditPoints: *creditPointsFlag,
+			StartPeriod:  start,
+			MaxSemesters: *semestersFlag,
+		})
+		if *jsonFlag {
+			return printJSON(plan)
+		}
+		fmt.Print(process.FormatStudyPlan(plan))
+		return nil
+	}
+}
+
+func setupValidate(fs *flag.FlagSet) func(*config.Config, storage.Store, string) error {
+	planFlag := fs.String("plan", "", "JSON or YAML study plan file (required)")
+	monplanFlag := fs.Bool("monplan", false, "also send the plan to MonPlan and diff the two answers")
+	jsonFlag := fs.Bool("json", false, "print the result as JSON")
+	return func(settings *config.Config, store storage.Store, _ string) error {
+		if *planFlag == "" {
+			return usagef("validate needs --plan")
+		}
+		units, err := loadProcessedUnits(store)
+		if err != nil {
+			return fmt.Errorf("loading processed units: %w", err)
+		}
+		plan, err := process.LoadPlanFile(*planFlag)
+		if err != nil {
+			return fmt.Errorf("loading plan: %w", err)
+		}
+
+		local := process.ValidatePlan(units, plan)
+		if !*monplanFlag {
+			if *jsonFlag {
+				return printJSON(local)
+			}
+			printCourseErrors("Plan errors", local.CourseErrors)
+			printCourseErrors("Warnings", local.Warnings)
+			return nil
+		}
+
+		periods := make([]scrape.TeachingPeriod, 0)
+		for _, year := range plan.Years {
+			for _, period := range year.Periods {
+				periods = append(periods, scrape.TeachingPeriod{Year: year.Year, Code: period.Code, Units: period.Units})
+			}
+		}
+		response, err := scrape.PostPlan(settings.MonPlanURL, scrape.CreatePlanPayload(plan.StartYear, plan.Course, periods, plan.AdvancedStanding))
+		if err != nil {
+			return fmt.Errorf("MonPlan request failed: %w", err)
+		}
+
+		var remote process.Rule
+		data, err := json.Marshal(response)
+		if err != nil {
+			return fmt.Errorf("encoding MonPlan response: %w", err)
+		}
+		if err := json.Unmarshal(data, &remote); err != nil {
+			return fmt.Errorf("decoding MonPlan response: %w", err)
+		}
+		diff := process.DiffCourseErrors(local, remote.CourseErrors)
+
+		if *jsonFlag {
+			return printJSON(diff)
+		}
+		fmt.Printf("Matching MonPlan: %d\n", len(diff.Matching))
+		printCourseErrors("Only found locally", diff.OnlyLocal)
+		printCourseErrors("Only reported by MonPlan", diff.OnlyMonPlan)
+		printCourseErrors("Local warnings, not compared", diff.Warnings)
+		return nil
+	}
+}
+
+func setupGraph(fs *flag.FlagSet) func(*config.Config, storage.Store, string) error {
+	formatFlag := fs.String("format", "dot", "output format: "+strings.Join(graph.Formats, ", "))
+	facultyFlag := fs.String("faculty", "", "only graph units whose school or academic org contains this name")
+	unitFlag := fs.String("unit", "", "centre unit for an ego graph")
+	hopsFlag := fs.Int("hops", 1, "number of hops around --unit to include")
+	outFlag := fs.String("out", "", "file to write the graph to (default stdout)")
+	return func(settings *config.Config, store storage.Store, _ string) error {
+		known := false
+		for _, name := range append(graph.Formats, "mmd") {
+			known = known || strings.EqualFold(*formatFlag, name)
+		}
+		if !known {
+			return usagef("unknown graph format %q: want one of %s", *formatFlag, strings.Join(graph.Formats, ", "))
+		}
+		if *hopsFlag < 0 {
+			return usagef("--hops must not be negative")
+		}
+
+		units, err := loadProcessedUnits(store)
+		if err != nil {
+			return fmt.Errorf("loading processed units: %w", err)
+		}
+
+		requisiteGraph := graph.FromProcessed(units)
+		if *facultyFlag != "" {
+			requisiteGraph = requisiteGraph.Faculty(*facultyFlag, units)
+		}
+		if *unitFlag != "" {
+			requisiteGraph, err = requisiteGraph.Ego(codes.Normalise(*unitFlag), *hopsFlag)
+			if err != nil {
+				return err
+			}
+		}
+
+		output := os.Stdout
+		if *outFlag != "" {
+			output, err = os.Create(*outFlag)
+			if err != nil {
+				return fmt.Errorf("creating %s: %w", *outFlag, err)
+			}
+			defer output.Close()
+		}
+		if err := graph.Write(output, requisiteGraph, *formatFlag); err != nil {
+			return fmt.Errorf("writing graph: %w", err)
+		}
+		return nil
+	}
+}
+
+func setupConfig(fs *flag.FlagSet) func(*config.Config, storage.Store, string) error {
+	return func(settings *config.Config, store storage.Store, _ string) error {
+		return printJSON(settings)
+	}
+}
+
+// artefact is one value to put in the store.
+type artefact struct {
+	key   storage.Key
+	value interface{}
+}
+
+func putArtefacts(store storage.Store, artefacts ...artefact) error {
+	for _, item := range artefacts {
+		if err := store.Put(item.key, item.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadContentSplits returns the saved content index, fetching and saving a new one if there is none.
+func loadContentSplits(settings *config.Config, store storage.Store) (map[string][]string, error) {
+	var contentSplits map[string][]string
+	err := store.Get(storage.ContentSplits, &contentSplits)
+	if err == nil {
+		return contentSplits, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+
+	fmt.Println("Getting new index...")
+	contentSplits, err = scrape.FetchIndex(settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Put(storage.ContentSplits, contentSplits); err != nil {
+		return nil, fmt.Errorf("saving content splits: %w", err)
+	}
+	fmt.Println("Got new index!")
+	return contentSplits, nil
+}
+
+// scrapeContent scrapes the handbook for one kind of content into raw_<content>.
+// A fresh scrape starts from scratch; otherwise an existing scrape is continued by
+// retrying only the items <content>_failed still lists.
+func scrapeContent(settings *config.Config, store storage.Store, content string, fresh bool) error {
+	contentSplits, err := loadContentSplits(settings, store)
+	if err != nil {
+		return err
+	}
+
+	items := contentSplits[content]
+	continuing := false
+	if fresh {
+		// Remove the existing scrape, so an interrupted one is not continued later
+		for _, key := range []storage.Key{storage.Raw(content), storage.Failed(content)} {
+			if err := store.Delete(key); err != nil {
+				return err
+			}
+		}
+	} else {
+		_, err := store.Modified(storage.Raw(content))
+		switch {
+		case err == nil:
+			continuing = true
+			items = make([]string, 0)
+			if err := store.Get(storage.Failed(content), &items); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+			fmt.Printf("Continuing handbook scrape: %s\n", content)
+			if len(items) == 0 {
+				return nil
+			}
+		case !errors.Is(err, storage.ErrNotFound):
+			return err
+		}
+	}
+
+	result, scrapeErr := scrape.ScrapeHandbook(settings, items, content)
+	if result == nil {
+		return scrapeErr
+	}
+	// A continued scrape only adds the pages it fetched
+	if continuing {
+		err = store.AppendRaw(content, result.Items)
+	} else {
+		err = store.PutRaw(content, result.Items)
+	}
+	if err != nil {
+		return err
+	}
+	if err := store.Put(storage.Failed(content), result.Failed); err != nil {
+		return err
+	}
+	fmt.Printf("Saved %d %s\n", len(result.Items), content)
+	return scrapeErr
+}
+
+// formatContent formats one scraped collection. Units are checked against the saved
+// content index when there is one; format never fetches it.
+func formatContent(settings *config.Config, store storage.Store, content string) error {
+	fmt.Print("Formatting " + content + "\n")
+	var formatted_data map[string]interface{}
+	raw_data, err := store.GetRaw(content)
+	if err != nil {
+		return err
+	}
+
+	switch content {
+	case "units":
+		var index *codes.Index
+		var contentSplits map[string][]string
+		if err := store.Get(storage.ContentSplits, &contentSplits); err == nil {
+			index = codes.NewIndex(contentSplits["units"])
+		} else {
+			fmt.Println("No saved content index, accepting any well formed unit code")
+		}
+		formatted := format.FormatUnits(raw_data, index, settings.FallbackYear)
+		formatted_data = formatted.Units
+		// Save the detected year for the requisite scrape
+		err = putArtefacts(store,
+			artefact{storage.DetectedYear, map[string]string{"implementation_year": formatted.DetectedYear}},
+			artefact{storage.ProhibitionCandidates, formatted.ProhibitionCandidates},
+			artefact{storage.EquivalentUnitGroups, formatted.EquivalentUnitGroups},
+			artefact{storage.UnknownCodesUnits, formatted.UnknownCodes},
+			artefact{storage.UnclassifiedEnrolmentRules, formatted.UnclassifiedRules},
+			artefact{storage.MalformedUnits, formatted.Malformed},
+		)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Saved detected year: %s\n", formatted.DetectedYear)
+		fmt.Printf("Grouped %d prohibition candidate lists into %d equivalent unit groups\n", len(formatted.ProhibitionCandidates), len(formatted.EquivalentUnitGroups))
+		if len(formatted.UnknownCodes) > 0 {
+			fmt.Printf("Found %d enrolment rules naming codes outside the index\n", len(formatted.UnknownCodes))
+		}
+		fmt.Printf("Left %d enrolment rules unclassified\n", len(formatted.UnclassifiedRules))
+		for _, unit := range formatted.Malformed {
+			fmt.Printf("Skipped malformed unit %s: %s\n", unit.Unit, unit.Error)
+		}
+	case "aos":
+		formatted_data = format.FormatAOSs(raw_data)
+		if err := writeRequirementIssues(store, formatted_data, content); err != nil {
+			return err
+		}
+	case "courses":
+		formatted_data = format.FormatCourses(raw_data)
+		if err := writeRequirementIssues(store, formatted_data, content); err != nil {
+			return err
+		}
+	}
+
+	if err := store.PutFormatted(content, formatted_data); err != nil {
+		return err
+	}
+	fmt.Println("Succesfully formatted " + content + "\n")
+	return nil
+}
+
+// scrapeRequisites asks MonPlan about every unit on its own, then about each equivalent unit group.
+// Run this only after running the unit formatter.
+func scrapeRequisites(settings *config.Config, store storage.Store) error {
+	fmt.Print("Doing requisites\n")
+	contentSplits, err := loadContentSplits(settings, store)
+	if err != nil {
+		return fmt.Errorf("obtaining content index: %w", err)
+	}
+
+	// Load the detected year from the format step
+	year := settings.FallbackYear
+	var yearData map[string]string
+	if err := store.Get(storage.DetectedYear, &yearData); err == nil {
+		if detected, err := strconv.Atoi(yearData["implementation_year"]); err == nil {
+			year = detected
+			fmt.Printf("Using detected year: %d\n", year)
+		}
+	} else {
+		fmt.Printf("Warning: Could not load detected year, using default: %d\n", year)
+	}
+
+	var unitItems [][]string
+	for _, item := range contentSplits["units"] {
+		unitItems = append(unitItems, []string{item})
+	}
+
+	prerequisites, prerequisiteErr := scrape.FetchRequisites(settings, unitItems, year)
+	if prerequisiteErr != nil && !errors.Is(prerequisiteErr, scrape.ErrIncomplete) {
+		return fmt.Errorf("prerequisites: %w", prerequisiteErr)
+	}
+	if err := store.PutRequisites("prerequisites", prerequisites); err != nil {
+		return err
+	}
+
+	// Probe each equivalent unit group once, falling back to the per unit candidate lists
+	groupsKey := storage.EquivalentUnitGroups
+	var prohibitionCandidates [][]string
+	err = store.Get(groupsKey, &prohibitionCandidates)
+	if errors.Is(err, storage.ErrNotFound) {
+		groupsKey = storage.ProhibitionCandidates
+		err = store.Get(groupsKey, &prohibitionCandidates)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Probing %d prohibition groups from %s\n", len(prohibitionCandidates), groupsKey)
+	prohibitions, prohibitionErr := scrape.FetchRequisites(settings, prohibitionCandidates, year)
+	if prohibitionErr != nil && !errors.Is(prohibitionErr, scrape.ErrIncomplete) {
+		return fmt.Errorf("prohibitions: %w", prohibitionErr)
+	}
+	if err := store.PutRequisites("prohibitions", prohibitions); err != nil {
+		return err
+	}
+	if prohibitionErr != nil {
+		return fmt.Errorf("prohibitions: %w", prohibitionErr)
+	}
+	// A partial prerequisite scrape still fails the run once prohibitions are done
+	if prerequisiteErr != nil {
+		return fmt.Errorf("prerequisites: %w", prerequisiteErr)
+	}
+	return nil
+}
+
+// processUnits writes processed_units and its reports and, with all, the cross-referenced catalog.
+func processUnits(store storage.Store, all bool) error {
+	fmt.Println("Processing units")
+	var input process.ProcessInput
+	var err error
+	if input.Units, err = store.GetFormatted("units"); err != nil {
+		return err
+	}
+	if input.Prerequisites, err = loadRules(store, "prerequisites"); err != nil {
+		return err
+	}
+	if input.Prohibitions, err = loadRules(store, "prohibitions"); err != nil {
+		return err
+	}
+	courses, err := loadFormatted(store, "courses")
+	if err != nil {
+		return err
+	}
+	aos, err := loadFormatted(store, "aos")
+	if err != nil {
+		return err
+	}
+	input.Courses, input.AOS = courses, aos
+	// Check codes against the CourseLoop index when it was saved
+	var contentSplits map[string][]string
+	if err := store.Get(storage.ContentSplits, &contentSplits); err == nil && len(contentSplits["units"]) > 0 {
+		input.Index = codes.NewIndex(contentSplits["units"])
+	}
+
+	result, err := process.ProcessHandbook(input)
+	if err != nil {
+		return fmt.Errorf("processing units: %w", err)
+	}
+	err = putArtefacts(store,
+		artefact{storage.UnrecognisedRequisites, result.Unrecognised},
+		artefact{storage.UnknownCodesRequisites, result.UnknownCodes},
+		artefact{storage.RequisiteReconciliation, result.Reconciliation},
+		artefact{storage.GraphAnalysis, result.Analysis},
+	)
+	if err != nil {
+		return err
+	}
+	if err := store.PutProcessed(result.Units); err != nil {
+		return err
+	}
+	if len(result.Unrecognised) > 0 {
+		fmt.Printf("Could not parse %d MonPlan messages\n", len(result.Unrecognised))
+	}
+	if len(result.UnknownCodes) > 0 {
+		fmt.Printf("Found %d MonPlan messages naming codes outside the index\n", len(result.UnknownCodes))
+	}
+	fmt.Printf("Handbook and MonPlan requisites disagree %d times (%d high severity)\n", len(result.Reconciliation.Flags), result.Reconciliation.BySeverity[process.SeverityHigh])
+	for _, cycle := range result.Analysis.Cycles {
+		if cycle.Kind == process.CyclePrerequisite {
+			fmt.Printf("Prerequisite cycle between %s\n", strings.Join(cycle.Units, ", "))
+		}
+	}
+	fmt.Println("Succesfully processed units")
+
+	if !all {
+		return nil
+	}
+	catalog := process.BuildCatalog(result.Units, courses, aos)
+	err = store.PutCatalog(&storage.CatalogContents{
+		Units:      catalog.Units,
+		Courses:    catalog.Courses,
+		AOS:        catalog.AOS,
+		Validation: catalog.Validation,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Catalog has %d units, %d courses and %d areas of study\n", len(catalog.Units), len(catalog.Courses), len(catalog.AOS))
+	fmt.Printf("Dangling references: %d units, %d AOS, %d courses\n",
+		len(catalog.Validation.DanglingUnits), len(catalog.Validation.DanglingAOS), len(catalog.Validation.DanglingCourses))
+	return nil
+}
+
+// loadRules reads the MonPlan responses of one requisite probe.
+func loadRules(store storage.Store, probe string) ([]process.Rule, error) {
+	responses, err := store.GetRequisites(probe)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := process.RulesFromResponses(responses)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", probe, err)
+	}
+	return rules, nil
+}
+
+// loadProcessedUnits reads processed_units into typed records.
+func loadProcessedUnits(store storage.Store) (map[string]*process.ProcessedUnit, error) {
+	records, err := store.GetProcessed()
+	if err != nil {
+		return nil, err
+	}
+	units := make(map[string]*process.ProcessedUnit, len(records))
+	for code, record := range records {
+		var unit process.ProcessedUnit
+		if err := json.Unmarshal(record, &unit); err != nil {
+			return nil, fmt.Errorf("decoding processed unit %s: %w", code, err)
+		}
+		units[code] = &unit
+	}
+	return units, nil
+}
+
+// printJSON writes an indented report to stdout.
+func printJSON(value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding report: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// loadFormatted reads a previously formatted collection, returning an empty map if it is missing.
+func loadFormatted(store storage.Store, content string) (map[string]interface{}, error) {
+	formatted, err := store.GetFormatted(content)
+	if errors.Is(err, storage.ErrNotFound) {
+		return make(map[string]interface{}), nil
+	}
+	return formatted, err
+}
+
+// writeRequirementIssues resolves requirement trees against formatted units and AOS,
+// and records nodes whose children cannot satisfy them.
+func writeRequirementIssues(store storage.Store, formatted_data map[string]interface{}, content string) error {
+	aos, err := loadFormatted(store, "aos")
+	if err != nil {
+		return err
+	}
+	if content == "aos" {
+		aos = formatted_data
+	}
+	units, err := loadFormatted(store, "units")
+	if err != nil {
+		return err
+	}
+	issues := format.ValidateRequirements(formatted_data, units, aos)
+
+	if err := store.Put(storage.RequirementIssues(content), issues); err != nil {
+		return err
+	}
+	fmt.Printf("Found %d requirement issues in %s\n", len(issues), content)
+	return nil
+}
+
+// splitUnits turns a comma separated flag value into unit codes.
+func splitUnits(value string) []string {
+	units := make([]string, 0)
+	for _, unit := range strings.Split(value, ",") {
+		if unit = strings.TrimSpace(unit); unit != "" {
+			units = append(units, codes.Normalise(unit))
+		}
+	}
+	return units
+}
+
+func printCourseErrors(heading string, courseErrors []process.EnrolmentError) {
+	fmt.Printf("%s: %d\n", heading, len(courseErrors))
+	for _, courseError := range courseErrors {
+		reference := process.References{}
+		if len(courseError.References) > 0 {
+			reference = courseError.References[0]
+		}
+		fmt.Printf("  %d %s %s [%s] %s: %s\n", reference.TeachingPeriodStartingYear, reference.TeachingPeriodCode, reference.UnitCode, courseError.Level, courseError.Title, courseError.Description)
+	}
+}
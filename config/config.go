@@ -0,0 +1,232 @@
+// Settings for the scrape, format and process steps.
+// Each setting is resolved once, later sources winning over earlier ones:
+// built in defaults, the JSON config file, HANDBOOK_* environment variables, then command line flags.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultFile = "handbook.json"
+	EnvFile     = "HANDBOOK_CONFIG"
+	envPrefix   = "HANDBOOK_"
+)
+
+// Duration is a time.Duration written as "7m0s" in the config file.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string like \"7m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+type Config struct {
+	// Where pipeline files are read from and written to
+	DataDir string `json:"data_dir"`
+	// How they are kept there: "files" or "sqlite"
+	Storage string `json:"storage"`
+
+	// Handbook scrape
+	Workers     int      `json:"workers"`
+	Pause       Duration `json:"pause"`
+	Retries     int      `json:"retries"`
+	IndexURL    string   `json:"index_url"`
+	SiteID      string   `json:"site_id"`
+	PageSize    int      `json:"page_size"`
+	HandbookURL string   `json:"handbook_url"`
+
+	// Requisite scrape
+	MonPlanURL string `json:"monplan_url"`
+
+	// Used when the scraped units carry no implementation year
+	FallbackYear int `json:"fallback_year"`
+}
+
+// Setting describes one key of the config file.
+type Setting struct {
+	Key   string
+	Usage string
+}
+
+// Settings lists every key, in the order they are documented.
+var Settings = []Setting{
+	{"data_dir", "directory pipeline files are read from and written to"},
+	{"storage", "storage backend: files (one JSON file per artefact) or sqlite (handbook.db)"},
+	{"workers", "number of parallel requests per scrape"},
+	{"pause", "pause between handbook scrape attempts, e.g. 7m"},
+	{"retries", "number of times rate limited handbook items are retried"},
+	{"index_url", "CourseLoop search endpoint for the handbook index"},
+	{"site_id", "CourseLoop site id for the handbook index"},
+	{"page_size", "number of index entries fetched per request"},
+	{"handbook_url", "handbook Next.js data URL, including the build id"},
+	{"monplan_url", "MonPlan validation endpoint"},
+	{"fallback_year", "implementation year when the scraped units do not name one"},
+}
+
+func Default() *Config {
+	return &Config{
+		DataDir:      "data",
+		Storage:      "files",
+		Workers:      10,
+		Pause:        Duration{7 * time.Minute},
+		Retries:      4,
+		IndexURL:     "https://api-ap-southeast-2.prod.courseloop.com/publisher/search-all",
+		SiteID:       "monash-prod-pres",
+		PageSize:     100,
+		HandbookURL:  "https://handbook.monash.edu/_next/data/x72Bg6G_Gp9JqA01tHcsD",
+		MonPlanURL:   "https://mscv.apps.monash.edu",
+		FallbackYear: 2024,
+	}
+}
+
+// Set assigns one setting from its text form, as given in the environment or on the command line.
+func (config *Config) Set(key string, value string) error {
+	var err error
+	switch key {
+	case "data_dir":
+		config.DataDir = value
+	case "storage":
+		config.Storage = value
+	case "workers":
+		config.Workers, err = strconv.Atoi(value)
+	case "pause":
+		config.Pause.Duration, err = time.ParseDuration(value)
+	case "retries":
+		config.Retries, err = strconv.Atoi(value)
+	case "index_url":
+		config.IndexURL = value
+	case "site_id":
+		config.SiteID = value
+	case "page_size":
+		config.PageSize, err = strconv.Atoi(value)
+	case "handbook_url":
+		config.HandbookURL = strings.TrimSuffix(value, "/")
+	case "monplan_url":
+		config.MonPlanURL = value
+	case "fallback_year":
+		config.FallbackYear, err = strconv.Atoi(value)
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	if err != nil {
+		return fmt.Errorf("setting %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get returns one setting in the text form Set accepts.
+func (config *Config) Get(key string) (string, error) {
+	switch key {
+	case "data_dir":
+		return config.DataDir, nil
+	case "storage":
+		return config.Storage, nil
+	case "workers":
+		return strconv.Itoa(config.Workers), nil
+	case "pause":
+		return config.Pause.String(), nil
+	case "retries":
+		return strconv.Itoa(config.Retries), nil
+	case "index_url":
+		return config.IndexURL, nil
+	case "site_id":
+		return config.SiteID, nil
+	case "page_size":
+		return strconv.Itoa(config.PageSize), nil
+	case "handbook_url":
+		return config.HandbookURL, nil
+	case "monplan_url":
+		return config.MonPlanURL, nil
+	case "fallback_year":
+		return strconv.Itoa(config.FallbackYear), nil
+	}
+	return "", fmt.Errorf("unknown setting %q", key)
+}
+
+// Validate rejects settings the pipeline cannot run with.
+func (config *Config) Validate() error {
+	switch {
+	case config.DataDir == "":
+		return errors.New("data_dir must not be empty")
+	case config.Storage != "files" && config.Storage != "sqlite":
+		return fmt.Errorf("storage must be files or sqlite, got %q", config.Storage)
+	case config.Workers < 1:
+		return fmt.Errorf("workers must be at least 1, got %d", config.Workers)
+	case config.Pause.Duration < 0:
+		return fmt.Errorf("pause must not be negative, got %s", config.Pause)
+	case config.Retries < 0:
+		return fmt.Errorf("retries must not be negative, got %d", config.Retries)
+	case config.PageSize < 1:
+		return fmt.Errorf("page_size must be at least 1, got %d", config.PageSize)
+	}
+	return nil
+}
+
+// EnvName is the environment variable overriding a setting, e.g. HANDBOOK_WORKERS.
+func EnvName(key string) string {
+	return envPrefix + strings.ToUpper(key)
+}
+
+// FlagName is the command line flag overriding a setting, e.g. --fallback-year.
+func FlagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// Load merges the defaults, the config file and the environment.
+// An empty path falls back to $HANDBOOK_CONFIG, then to handbook.json if it exists.
+func Load(path string) (*Config, error) {
+	config := Default()
+
+	required := path != ""
+	if path == "" {
+		path = os.Getenv(EnvFile)
+		required = path != ""
+	}
+	if path == "" {
+		path = DefaultFile
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(config); err != nil {
+			return nil, fmt.Errorf("decoding config %s: %w", path, err)
+		}
+	case required || !os.IsNotExist(err):
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+
+	for _, setting := range Settings {
+		if value, ok := os.LookupEnv(EnvName(setting.Key)); ok {
+			if err := config.Set(setting.Key, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", EnvName(setting.Key), err)
+			}
+		}
+	}
+	return config, nil
+}
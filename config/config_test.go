@@ -0,0 +1,96 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file into a temporary directory and returns its path.
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), DefaultFile)
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `{"workers": 3, "retries": 2, "pause": "1m"}`)
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		workers int
+		retries int
+	}{
+		{"file over defaults", nil, 3, 2},
+		{"environment over file", map[string]string{"HANDBOOK_WORKERS": "5"}, 5, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			config, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Workers != test.workers || config.Retries != test.retries {
+				t.Errorf("workers %d, retries %d, want %d, %d", config.Workers, config.Retries, test.workers, test.retries)
+			}
+			// Unset keys keep their defaults
+			if config.PageSize != Default().PageSize || config.Pause.Duration != time.Minute {
+				t.Errorf("page_size %d, pause %s", config.PageSize, config.Pause)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	t.Setenv(EnvFile, writeConfig(t, `{"storage": "sqlite"}`))
+	config, err := Load("")
+	if err != nil || config.Storage != "sqlite" {
+		t.Errorf("Load from $%s: storage %v, err %v", EnvFile, config, err)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("want an error for a named config file that does not exist")
+	}
+	if _, err := Load(writeConfig(t, `{"wokers": 3}`)); err == nil {
+		t.Error("want an error for an unknown key")
+	}
+
+	t.Setenv("HANDBOOK_WORKERS", "many")
+	if _, err := Load(writeConfig(t, `{}`)); err == nil {
+		t.Error("want an error for a malformed environment value")
+	}
+}
+
+// Every documented setting reads back in the form Set accepts.
+func TestGetSetRoundTrip(t *testing.T) {
+	defaults := Default()
+	config := &Config{}
+	for _, setting := range Settings {
+		value, err := defaults.Get(setting.Key)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", setting.Key, err)
+		}
+		if err := config.Set(setting.Key, value); err != nil {
+			t.Fatalf("Set(%s, %q): %v", setting.Key, value, err)
+		}
+	}
+	if *config != *defaults {
+		t.Errorf("got %+v, want %+v", config, defaults)
+	}
+
+	if err := config.Set("workers", "ten"); err == nil {
+		t.Error("want an error for a non numeric worker count")
+	}
+	if _, err := config.Get("colour"); err == nil {
+		t.Error("want an error for an unknown setting")
+	}
+}
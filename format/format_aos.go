@@ -1,21 +1,10 @@
 package format
 
-import "strconv"
-
-// Helper function to parse int values safely
-func parseInt(value interface{}) int {
-	if v, ok := value.(string); ok {
-		if intValue, err := strconv.Atoi(v); err == nil {
-			return intValue
-		}
-	}
-	if v, ok := value.(float64); ok {
-		return int(v)
-	}
-	return 0
-}
 func FormatAOS(raw_aos map[string]interface{}) map[string]interface{} {
 	// Extract curriculumStructure.container if available
+	structure := FormatStructure(raw_aos)
+	requirements := BuildRequirementTree(labelOrValue(raw_aos["title"]), structure)
+	coreUnits, electiveUnits := CoreAndElectiveUnits(requirements)
 
 	return map[string]interface{}{
 		"title":                raw_aos["title"],
@@ -24,9 +13,13 @@ func FormatAOS(raw_aos map[string]interface{}) map[string]interface{} {
 		"credit_points":        raw_aos["credit_points"],
 		"handbook_description": raw_aos["handbook_description"],
 		"aos_type":             raw_aos["academic_item_type"],
-		"school":               raw_aos["school"].(map[string]interface{})["name"],
+		"school":               nestedField(raw_aos, "school", "name"),
 		"locations":            raw_aos["aos_offering_locations"],
-		"curriculum_structure": FormatStructure(raw_aos),
+		"curriculum_structure": structure,
+		"requirements":         requirements,
+		"core_units":           coreUnits,
+		"elective_units":       electiveUnits,
+		"total_credit_points":  TotalCreditPoints(raw_aos["credit_points"], requirements),
 	}
 }
 
@@ -1,17 +1,161 @@
 package format
 
+import (
+	"handbook-scraper/codes"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	coursePattern   = regexp.MustCompile(`^[A-Z][0-9]{4}$`)
+	durationPattern = regexp.MustCompile(`[0-9]+(\.[0-9]+)?`)
+)
+
+// nestedField safely reads raw[key][field], returning nil if either level is missing.
+func nestedField(raw map[string]interface{}, key string, field string) interface{} {
+	if inner, ok := raw[key].(map[string]interface{}); ok {
+		return inner[field]
+	}
+	return nil
+}
+
+// labelOrValue pulls a display string out of a CourseLoop {label, value} pair or a bare string.
+func labelOrValue(raw interface{}) string {
+	switch v := raw.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]interface{}:
+		for _, key := range []string{"label", "value", "name"} {
+			if s, ok := v[key].(string); ok && s != "" {
+				return strings.TrimSpace(s)
+			}
+		}
+	}
+	return ""
+}
+
+// parseDuration reads a duration in years from strings such as "3 years" or "1.5".
+func parseDuration(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case string:
+		if years, err := strconv.ParseFloat(durationPattern.FindString(v), 64); err == nil {
+			return years
+		}
+	case map[string]interface{}:
+		return parseDuration(labelOrValue(v))
+	}
+	return 0
+}
+
+// getCourseOfferings collects the distinct locations and attendance modes a course is offered in.
+// Course offerings have the same shape as a unit's unit_offering.
+func getCourseOfferings(raw_course map[string]interface{}) ([]string, []string) {
+	locations := make([]string, 0)
+	modes := make([]string, 0)
+	seenLocations := make(map[string]bool)
+	seenModes := make(map[string]bool)
+
+	raw_offerings, _ := raw_course["course_offering"].([]interface{})
+	for _, raw_offering := range raw_offerings {
+		offering, ok := raw_offering.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if location, _ := nestedField(offering, "location", "value").(string); location != "" && !seenLocations[location] {
+			seenLocations[location] = true
+			locations = append(locations, location)
+		}
+		if mode, _ := nestedField(offering, "attendance_mode", "value").(string); mode != "" && !seenModes[mode] {
+			seenModes[mode] = true
+			modes = append(modes, mode)
+		}
+	}
+
+	return locations, modes
+}
+
+// getCourseType classifies a course as a single, double or honours degree.
+func getCourseType(raw_course map[string]interface{}, components []string) string {
+	title, _ := raw_course["title"].(string)
+
+	if len(components) > 1 || strings.Count(title, "Bachelor of")+strings.Count(title, "Master of") > 1 {
+		return "double"
+	}
+	if strings.Contains(strings.ToLower(title), "honours") {
+		return "honours"
+	}
+	return "single"
+}
+
+// collectStructureCodes walks a curriculum structure, splitting referenced codes into
+// component courses and areas of study. Unit codes are left to the requirement tree.
+func collectStructureCodes(structure []StructureElement, courses map[string]bool, aos map[string]bool) {
+	for _, element := range structure {
+		for code := range element.Courses {
+			switch {
+			case coursePattern.MatchString(code):
+				courses[code] = true
+			case !codes.IsUnitCode(code):
+				aos[code] = true
+			}
+		}
+		collectStructureCodes(element.Structure, courses, aos)
+	}
+}
+
+// getComponentCourses lists the single degrees that make up a double degree: the course codes
+// its curriculum structure references, other than its own.
+func getComponentCourses(raw_course map[string]interface{}, structureCourses map[string]bool) []string {
+	code, _ := raw_course["code"].(string)
+	components := make([]string, 0, len(structureCourses))
+	for componentCode := range structureCourses {
+		if componentCode != code {
+			components = append(components, componentCode)
+		}
+	}
+	sort.Strings(components)
+	return components
+}
+
 func FormatCourse(raw_course map[string]interface{}) map[string]interface{} {
 	// Extract curriculumStructure.container if available, 73 courses without course maps
+	structure := FormatStructure(raw_course)
+
+	structureCourses := make(map[string]bool)
+	structureAOS := make(map[string]bool)
+	collectStructureCodes(structure, structureCourses, structureAOS)
+
+	aosCodes := make([]string, 0, len(structureAOS))
+	for code := range structureAOS {
+		aosCodes = append(aosCodes, code)
+	}
+	sort.Strings(aosCodes)
+
+	components := getComponentCourses(raw_course, structureCourses)
+	locations, modes := getCourseOfferings(raw_course)
 
 	return map[string]interface{}{
 		"title":                raw_course["title"],
 		"code":                 raw_course["code"],
 		"abbreviated_name":     raw_course["abbreviated_name"],
-		"aqf_level":            raw_course["aqf_level"].(map[string]interface{})["label"],
+		"aqf_level":            nestedField(raw_course, "aqf_level", "label"),
 		"aos_type":             raw_course["academic_item_type"],
-		"school":               raw_course["school"].(map[string]interface{})["value"],
+		"school":               nestedField(raw_course, "school", "value"),
+		"course_type":          getCourseType(raw_course, components),
+		"credit_points":        codes.ParseInt(raw_course["credit_points"]),
+		"standard_duration":    parseDuration(raw_course["full_time_duration"]),
+		"maximum_duration":     parseDuration(raw_course["maximum_duration"]),
+		"locations":            locations,
+		"attendance_modes":     modes,
+		"component_courses":    components,
+		"aos_codes":            aosCodes,
 		"structure":            raw_course["structure"],
-		"curriculum_structure": FormatStructure(raw_course),
+		"curriculum_structure": structure,
+		"requirements":         BuildRequirementTree(labelOrValue(raw_course["title"]), structure),
 	}
 }
 
@@ -0,0 +1,209 @@
+package format
+
+import (
+	"handbook-scraper/codes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Classifies the free-text enrolment rules on a unit into structured constraints.
+// Each classifier recognises one kind of constraint; a rule may yield several.
+// Add entries to enrolmentRuleClassifiers to grow the rule set.
+
+const (
+	ConstraintProhibition       = "prohibition"
+	ConstraintCourseRestriction = "course_restriction"
+	ConstraintCourseExclusion   = "course_exclusion"
+	ConstraintCreditPoints      = "credit_points"
+	ConstraintWAM               = "wam"
+	ConstraintPermission        = "permission"
+)
+
+type EnrolmentConstraint struct {
+	Kind         string   `json:"kind"`
+	Units        []string `json:"units,omitempty"`
+	Courses      []string `json:"courses,omitempty"`
+	CreditPoints int      `json:"credit_points,omitempty"`
+	Level        int      `json:"level,omitempty"`
+	WAM          float64  `json:"wam,omitempty"`
+	Text         string   `json:"text"`
+}
+
+type UnclassifiedRule struct {
+	Unit string `json:"unit"`
+	Text string `json:"text"`
+}
+
+type enrolmentRuleClassifier struct {
+	kind     string
+	pattern  *regexp.Regexp
+	classify func(match []string, text string, constraint EnrolmentConstraint) []EnrolmentConstraint
+}
+
+var (
+	htmlTagPattern        = regexp.MustCompile(`<[^>]+>`)
+	courseCodePattern     = regexp.MustCompile(`\b[A-Z][0-9]{4}\b`)
+	prohibitionPattern    = regexp.MustCompile(`(?i)prohibit`)
+	otherRequisitePattern = regexp.MustCompile(`(?i)\b(?:pre|co)-?requisites?\b`)
+	// An amount of credit points, or the amount in "including 12 at level 2"
+	creditAmountPattern = regexp.MustCompile(`(?i)\b([0-9]{1,3})\s*(?:credit points|cp)\b|\bincluding\s+([0-9]{1,3})\b`)
+	// A level qualifying the amount just before it, with no other number in between
+	creditLevelPattern   = regexp.MustCompile(`(?i)^[^0-9]{0,30}?\bat (?:level|year) ([1-9])`)
+	enrolmentWordPattern = regexp.MustCompile(`(?i)\b(enrol(?:led)? in|admitted to|available (?:only )?to|restricted to|students in)\b`)
+	// negatedPattern marks rules that keep students of a course out rather than restrict the unit to it
+	negatedPattern = regexp.MustCompile(`(?i)\b(not (?:available|open) to|cannot|can not|not be enrolled|not permitted|excluded|exclusion)\b`)
+
+	enrolmentRuleClassifiers = []enrolmentRuleClassifier{
+		{
+			kind:    ConstraintProhibition,
+			pattern: prohibitionPattern,
+			classify: func(match []string, text string, constraint EnrolmentConstraint) []EnrolmentConstraint {
+				return []EnrolmentConstraint{constraint}
+			},
+		},
+		{
+			kind:    ConstraintCourseRestriction,
+			pattern: enrolmentWordPattern,
+			classify: func(match []string, text string, constraint EnrolmentConstraint) []EnrolmentConstraint {
+				constraint.Courses = courseCodePattern.FindAllString(text, -1)
+				if len(constraint.Courses) == 0 || negatedPattern.MatchString(text) {
+					return nil
+				}
+				return []EnrolmentConstraint{constraint}
+			},
+		},
+		{
+			kind:    ConstraintCourseExclusion,
+			pattern: enrolmentWordPattern,
+			classify: func(match []string, text string, constraint EnrolmentConstraint) []EnrolmentConstraint {
+				constraint.Courses = courseCodePattern.FindAllString(text, -1)
+				if len(constraint.Courses) == 0 || !negatedPattern.MatchString(text) {
+					return nil
+				}
+				return []EnrolmentConstraint{constraint}
+			},
+		},
+		{
+			kind:    ConstraintCreditPoints,
+			pattern: regexp.MustCompile(`(?i)([0-9]{1,3})\s*(?:credit points|cp)\b`),
+			classify: func(match []string, text string, constraint EnrolmentConstraint) []EnrolmentConstraint {
+				// "48 credit points including 12 at level 2" is 48 overall and 12 of them at level 2
+				constraints := make([]EnrolmentConstraint, 0)
+				for _, loc := range creditAmountPattern.FindAllStringSubmatchIndex(text, -1) {
+					start, end := loc[2], loc[3]
+					if start < 0 {
+						start, end = loc[4], loc[5]
+					}
+					amount := text[start:end]
+					points := constraint
+					points.CreditPoints, _ = strconv.Atoi(amount)
+					if level := creditLevelPattern.FindStringSubmatch(text[loc[1]:]); level != nil {
+						points.Level, _ = strconv.Atoi(level[1])
+					}
+					if points.CreditPoints > 0 {
+						constraints = append(constraints, points)
+					}
+				}
+				return constraints
+			},
+		},
+		{
+			kind:    ConstraintWAM,
+			pattern: regexp.MustCompile(`(?i)(?:\bWAM\b|weighted average mark)[^0-9.]{0,40}([0-9]{2,3}(?:\.[0-9]+)?)|([0-9]{2,3}(?:\.[0-9]+)?)\s*(?:or (?:above|more|higher)\s*)?(?:\bWAM\b|weighted average mark)`),
+			classify: func(match []string, text string, constraint EnrolmentConstraint) []EnrolmentConstraint {
+				value := match[1]
+				if value == "" {
+					value = match[2]
+				}
+				constraint.WAM, _ = strconv.ParseFloat(value, 64)
+				if constraint.WAM <= 0 {
+					return nil
+				}
+				return []EnrolmentConstraint{constraint}
+			},
+		},
+		{
+			kind:    ConstraintPermission,
+			pattern: regexp.MustCompile(`(?i)\b(permission|approval|consent)\b`),
+			classify: func(match []string, text string, constraint EnrolmentConstraint) []EnrolmentConstraint {
+				return []EnrolmentConstraint{constraint}
+			},
+		},
+	}
+)
+
+// cleanRuleText strips the HTML markup and collapses whitespace in a handbook rule description.
+func cleanRuleText(text string) string {
+	return strings.Join(strings.Fields(htmlTagPattern.ReplaceAllString(text, " ")), " ")
+}
+
+// prohibitedText is the part of a rule naming the prohibited units: from the "prohibit" keyword
+// up to the next prerequisite or corequisite clause, so units those clauses name are left out.
+func prohibitedText(text string) string {
+	loc := prohibitionPattern.FindStringIndex(text)
+	if loc == nil {
+		return ""
+	}
+	rest := text[loc[1]:]
+	if next := otherRequisitePattern.FindStringIndex(rest); next != nil {
+		rest = rest[:next[0]]
+	}
+	return rest
+}
+
+// ClassifyEnrolmentRule runs every classifier over a rule and returns the constraints it recognised.
+// Unit codes are validated against the index; codes outside it are returned separately.
+func ClassifyEnrolmentRule(text string, index *codes.Index) ([]EnrolmentConstraint, []string) {
+	cleaned := cleanRuleText(text)
+	_, unknown := index.Extract(cleaned)
+	constraints := make([]EnrolmentConstraint, 0)
+
+	for _, classifier := range enrolmentRuleClassifiers {
+		match := classifier.pattern.FindStringSubmatch(cleaned)
+		if match == nil {
+			continue
+		}
+		classified := classifier.classify(match, cleaned, EnrolmentConstraint{Kind: classifier.kind, Text: text})
+		if classifier.kind == ConstraintProhibition {
+			for idx := range classified {
+				classified[idx].Units, _ = index.Extract(prohibitedText(cleaned))
+			}
+		}
+		constraints = append(constraints, classified...)
+	}
+
+	return constraints, unknown
+}
+
+// classifyUnitRules classifies every enrolment rule on a raw unit.
+// Returns the constraints, the rules nothing recognised, and rule text naming codes outside the index.
+func classifyUnitRules(raw_unit map[string]interface{}, index *codes.Index) ([]EnrolmentConstraint, []UnclassifiedRule, []codes.UnknownCodes) {
+	constraints := make([]EnrolmentConstraint, 0)
+	unclassified := make([]UnclassifiedRule, 0)
+	unknown := make([]codes.UnknownCodes, 0)
+	code, _ := raw_unit["code"].(string)
+
+	rules, _ := raw_unit["enrolment_rules"].([]interface{})
+	for _, rule := range rules {
+		ruleMap, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		description, ok := ruleMap["description"].(string)
+		if !ok || strings.TrimSpace(description) == "" {
+			continue
+		}
+
+		ruleConstraints, missing := ClassifyEnrolmentRule(description, index)
+		if len(ruleConstraints) == 0 {
+			unclassified = append(unclassified, UnclassifiedRule{Unit: code, Text: description})
+		}
+		if len(missing) > 0 {
+			unknown = append(unknown, codes.UnknownCodes{Item: code, Codes: missing, Text: description})
+		}
+		constraints = append(constraints, ruleConstraints...)
+	}
+
+	return constraints, unclassified, unknown
+}
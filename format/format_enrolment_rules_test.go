@@ -0,0 +1,64 @@
+package format
+
+import (
+	"reflect"
+	"testing"
+
+	"handbook-scraper/codes"
+)
+
+func TestClassifyEnrolmentRule(t *testing.T) {
+	index := codes.NewIndex([]string{"FIT1045", "FIT1053", "FIT2004"})
+
+	tests := []struct {
+		name string
+		text string
+		want []EnrolmentConstraint
+	}{
+		{
+			name: "prohibition after a prerequisite",
+			text: "Prerequisite: FIT1045. Prohibition: FIT1053",
+			want: []EnrolmentConstraint{{Kind: ConstraintProhibition, Units: []string{"FIT1053"}}},
+		},
+		{
+			name: "prohibition before a prerequisite",
+			text: "Prohibition: FIT1053. Prerequisite: FIT1045",
+			want: []EnrolmentConstraint{{Kind: ConstraintProhibition, Units: []string{"FIT1053"}}},
+		},
+		{
+			name: "credit points including some at a level",
+			text: "Must have passed 48 credit points including 12 at level 2",
+			want: []EnrolmentConstraint{
+				{Kind: ConstraintCreditPoints, CreditPoints: 48},
+				{Kind: ConstraintCreditPoints, CreditPoints: 12, Level: 2},
+			},
+		},
+		{
+			name: "credit points at a level",
+			text: "Must have passed 24 credit points at level 2",
+			want: []EnrolmentConstraint{{Kind: ConstraintCreditPoints, CreditPoints: 24, Level: 2}},
+		},
+		{
+			name: "course restriction",
+			text: "Must be enrolled in C2001",
+			want: []EnrolmentConstraint{{Kind: ConstraintCourseRestriction, Courses: []string{"C2001"}}},
+		},
+		{
+			name: "course exclusion",
+			text: "Not available to students enrolled in C2000",
+			want: []EnrolmentConstraint{{Kind: ConstraintCourseExclusion, Courses: []string{"C2000"}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, _ := ClassifyEnrolmentRule(test.text, index)
+			for idx := range test.want {
+				test.want[idx].Text = test.text
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"handbook-scraper/codes"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Interprets a curriculum structure as a requirement tree.
+// Containers become AND/OR/choose-N nodes and relationships become unit, AOS or course leaves.
+// A container needing fewer credit points than its children offer is a choose node with no
+// count, met once its children earn MinCreditPoints.
+
+type RequirementKind string
+
+const (
+	RequirementAll    RequirementKind = "all"
+	RequirementAny    RequirementKind = "any"
+	RequirementChoose RequirementKind = "choose"
+	RequirementUnit   RequirementKind = "unit"
+	RequirementAOS    RequirementKind = "aos"
+	RequirementCourse RequirementKind = "course"
+)
+
+type RequirementNode struct {
+	Kind            RequirementKind    `json:"kind"`
+	Title           string             `json:"title,omitempty"`
+	Code            string             `json:"code,omitempty"`
+	Name            string             `json:"name,omitempty"`
+	MinCreditPoints int                `json:"min_credit_points,omitempty"`
+	Choose          int                `json:"choose,omitempty"`
+	CreditPoints    int                `json:"credit_points,omitempty"`
+	Resolved        bool               `json:"resolved,omitempty"`
+	Children        []*RequirementNode `json:"children,omitempty"`
+}
+
+type RequirementIssue struct {
+	Item    string `json:"item"`
+	Node    string `json:"node"`
+	Problem string `json:"problem"`
+}
+
+var (
+	chooseCountPattern = regexp.MustCompile(`(?i)\b([0-9]+|one|two|three|four|five|six|seven|eight|nine|ten|eleven|twelve)\s+(?:units?|of the following|from)`)
+)
+
+// DefaultUnitCreditPoints is assumed for unit leaves that have not been resolved to a record.
+const DefaultUnitCreditPoints = 6
+
+// parseChooseCount reads "complete two units from" style counts out of a container's text.
+func parseChooseCount(text string) int {
+	match := chooseCountPattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0
+	}
+	if num, err := strconv.Atoi(match[1]); err == nil {
+		return num
+	}
+	return codes.NumberWords[strings.ToLower(match[1])]
+}
+
+// leafKind guesses what a structure relationship points at from the shape of its code.
+func leafKind(code string) RequirementKind {
+	switch {
+	case codes.IsUnitCode(code):
+		return RequirementUnit
+	case coursePattern.MatchString(code):
+		return RequirementCourse
+	default:
+		return RequirementAOS
+	}
+}
+
+func buildRequirementNode(element StructureElement) *RequirementNode {
+	node := &RequirementNode{
+		Kind:            RequirementAll,
+		Title:           element.Title,
+		MinCreditPoints: element.CreditPoints,
+		Children:        make([]*RequirementNode, 0),
+	}
+
+	leafCodes := make([]string, 0, len(element.Courses))
+	for code := range element.Courses {
+		leafCodes = append(leafCodes, code)
+	}
+	sort.Strings(leafCodes)
+
+	for _, code := range leafCodes {
+		node.Children = append(node.Children, &RequirementNode{
+			Kind: leafKind(code),
+			Code: code,
+			Name: element.Courses[code],
+		})
+	}
+
+	for _, child := range element.Structure {
+		node.Children = append(node.Children, buildRequirementNode(child))
+	}
+
+	if strings.EqualFold(strings.TrimSpace(element.ParentConnector), "OR") {
+		node.Kind = RequirementAny
+	}
+	// A count naming every child is just an AND; one naming more is kept so CheckRequirements reports it
+	if count := parseChooseCount(element.Title + " " + element.Description); count > 0 && count != len(node.Children) {
+		node.Kind = RequirementChoose
+		node.Choose = count
+	}
+	chooseByCreditPoints(node)
+
+	return node
+}
+
+// chooseByCreditPoints turns an AND container into a choice by credit points when its children
+// offer more than its minimum, e.g. "12 credit points from" four 6 point units, and back again
+// when resolved credit points show every child is needed.
+func chooseByCreditPoints(node *RequirementNode) {
+	if node.MinCreditPoints <= 0 {
+		return
+	}
+	if node.Kind != RequirementAll && !(node.Kind == RequirementChoose && node.Choose == 0) {
+		return
+	}
+	// Nested containers count towards the minimum with their own
+	offered := 0
+	for _, child := range node.Children {
+		if child.MinCreditPoints > 0 {
+			offered += child.MinCreditPoints
+		} else {
+			offered += AttainableCreditPoints(child)
+		}
+	}
+	if offered > node.MinCreditPoints {
+		node.Kind = RequirementChoose
+	} else {
+		node.Kind = RequirementAll
+	}
+}
+
+// BuildRequirementTree turns a formatted curriculum structure into a single AND-rooted tree.
+func BuildRequirementTree(title string, structure []StructureElement) *RequirementNode {
+	root := &RequirementNode{
+		Kind:     RequirementAll,
+		Title:    title,
+		Children: make([]*RequirementNode, 0, len(structure)),
+	}
+	for _, element := range structure {
+		root.Children = append(root.Children, buildRequirementNode(element))
+	}
+	return root
+}
+
+// ResolveRequirements attaches each leaf to its unit or AOS record, filling in credit points.
+// Returns the codes that could not be found in either collection.
+func ResolveRequirements(node *RequirementNode, units map[string]interface{}, aos map[string]interface{}) []string {
+	unresolved := make([]string, 0)
+
+	switch node.Kind {
+	case RequirementUnit, RequirementAOS, RequirementCourse:
+		if unit, ok := units[node.Code].(map[string]interface{}); ok {
+			node.Kind = RequirementUnit
+			node.CreditPoints = codes.ParseInt(unit["credit_points"])
+			node.Resolved = true
+		} else if item, ok := aos[node.Code].(map[string]interface{}); ok {
+			node.Kind = RequirementAOS
+			node.CreditPoints = codes.ParseInt(item["credit_points"])
+			node.Resolved = true
+		} else if node.Kind != RequirementCourse {
+			unresolved = append(unresolved, node.Code)
+		}
+		return unresolved
+	}
+
+	for _, child := range node.Children {
+		unresolved = append(unresolved, ResolveRequirements(child, units, aos)...)
+	}
+	chooseByCreditPoints(node)
+	return unresolved
+}
+
+// AttainableCreditPoints is the most credit a student could earn under a node.
+func AttainableCreditPoints(node *RequirementNode) int {
+	switch node.Kind {
+	case RequirementUnit, RequirementAOS, RequirementCourse:
+		if node.CreditPoints > 0 {
+			return node.CreditPoints
+		}
+		if node.Kind == RequirementUnit {
+			return DefaultUnitCreditPoints
+		}
+		return 0
+	case RequirementChoose:
+		if node.Choose == 0 {
+			// Chosen by credit points, so any of the children may count
+			sum := 0
+			for _, child := range node.Children {
+				sum += AttainableCreditPoints(child)
+			}
+			return sum
+		}
+		totals := make([]int, 0, len(node.Children))
+		for _, child := range node.Children {
+			totals = append(totals, AttainableCreditPoints(child))
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(totals)))
+		sum := 0
+		for idx := 0; idx < node.Choose && idx < len(totals); idx++ {
+			sum += totals[idx]
+		}
+		return sum
+	default:
+		sum := 0
+		for _, child := range node.Children {
+			sum += AttainableCreditPoints(child)
+		}
+		return sum
+	}
+}
+
+// CheckRequirements flags nodes whose children cannot add up to the node's credit point minimum.
+// Children with unknown credit points (unresolved AOS or nested containers without
+// their own totals) are skipped rather than reported.
+func CheckRequirements(item string, node *RequirementNode) []RequirementIssue {
+	issues := make([]RequirementIssue, 0)
+
+	if node.Kind == RequirementChoose && node.Choose > len(node.Children) {
+		issues = append(issues, RequirementIssue{
+			Item:    item,
+			Node:    node.Title,
+			Problem: fmt.Sprintf("choose %d but only %d options", node.Choose, len(node.Children)),
+		})
+	}
+
+	if node.MinCreditPoints > 0 && len(node.Children) > 0 {
+		if attainable := AttainableCreditPoints(node); attainable > 0 && attainable < node.MinCreditPoints {
+			issues = append(issues, RequirementIssue{
+				Item:    item,
+				Node:    node.Title,
+				Problem: fmt.Sprintf("requires %d credit points but children provide at most %d", node.MinCreditPoints, attainable),
+			})
+		}
+	}
+
+	for _, child := range node.Children {
+		issues = append(issues, CheckRequirements(item, child)...)
+	}
+	return issues
+}
+
+// requirementsFromRecord reads the requirement tree of a formatted course or AOS. The formatter
+// holds it as a *RequirementNode; records decoded from JSON or the store hold a plain map.
+func requirementsFromRecord(record map[string]interface{}) (*RequirementNode, error) {
+	switch value := record["requirements"].(type) {
+	case nil:
+		return nil, nil
+	case *RequirementNode:
+		return value, nil
+	default:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		tree := &RequirementNode{}
+		if err := json.Unmarshal(data, tree); err != nil {
+			return nil, err
+		}
+		return tree, nil
+	}
+}
+
+// ValidateRequirements resolves and checks every requirement tree in a formatted course or AOS collection.
+// Records whose requirements cannot be read are reported rather than skipped.
+func ValidateRequirements(formatted map[string]interface{}, units map[string]interface{}, aos map[string]interface{}) []RequirementIssue {
+	issues := make([]RequirementIssue, 0)
+
+	for _, code := range codes.SortedKeys(formatted) {
+		item, ok := formatted[code].(map[string]interface{})
+		if !ok {
+			issues = append(issues, RequirementIssue{Item: code, Problem: "record is not an object"})
+			continue
+		}
+		tree, err := requirementsFromRecord(item)
+		if err != nil {
+			issues = append(issues, RequirementIssue{Item: code, Problem: fmt.Sprintf("cannot read requirements: %v", err)})
+			continue
+		}
+		if tree == nil {
+			continue
+		}
+		for _, missing := range ResolveRequirements(tree, units, aos) {
+			issues = append(issues, RequirementIssue{
+				Item:    code,
+				Node:    missing,
+				Problem: "no unit or AOS record",
+			})
+		}
+		issues = append(issues, CheckRequirements(code, tree)...)
+	}
+
+	return issues
+}
+
+// CoreAndElectiveUnits splits the unit leaves of a tree into units that must be taken
+// (reached only through AND nodes) and units that are one option among several.
+func CoreAndElectiveUnits(node *RequirementNode) ([]string, []string) {
+	core := make(map[string]bool)
+	elective := make(map[string]bool)
+	collectUnits(node, true, core, elective)
+
+	coreList := make([]string, 0, len(core))
+	for code := range core {
+		coreList = append(coreList, code)
+	}
+	electiveList := make([]string, 0, len(elective))
+	for code := range elective {
+		if !core[code] {
+			electiveList = append(electiveList, code)
+		}
+	}
+	sort.Strings(coreList)
+	sort.Strings(electiveList)
+	return coreList, electiveList
+}
+
+func collectUnits(node *RequirementNode, mandatory bool, core map[string]bool, elective map[string]bool) {
+	if node.Kind == RequirementUnit {
+		if mandatory {
+			core[node.Code] = true
+		} else {
+			elective[node.Code] = true
+		}
+		return
+	}
+	childMandatory := mandatory && node.Kind == RequirementAll
+	for _, child := range node.Children {
+		collectUnits(child, childMandatory, core, elective)
+	}
+}
+
+// TotalCreditPoints prefers the stated credit points and falls back to the top level minimums.
+func TotalCreditPoints(stated interface{}, node *RequirementNode) int {
+	if total := codes.ParseInt(stated); total > 0 {
+		return total
+	}
+	total := 0
+	for _, child := range node.Children {
+		total += child.MinCreditPoints
+	}
+	return total
+}
@@ -0,0 +1,157 @@
+package format
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func unitLeaf(code string, points int) *RequirementNode {
+	return &RequirementNode{Kind: RequirementUnit, Code: code, CreditPoints: points}
+}
+
+func TestChooseByCreditPoints(t *testing.T) {
+	tests := []struct {
+		name   string
+		node   *RequirementNode
+		kind   RequirementKind
+		choose int
+	}{
+		{
+			name: "children offer more than the minimum",
+			node: &RequirementNode{Kind: RequirementAll, MinCreditPoints: 12, Children: []*RequirementNode{unitLeaf("A", 6), unitLeaf("B", 6), unitLeaf("C", 6)}},
+			kind: RequirementChoose,
+		},
+		{
+			name: "children offer exactly the minimum",
+			node: &RequirementNode{Kind: RequirementAll, MinCreditPoints: 12, Children: []*RequirementNode{unitLeaf("A", 6), unitLeaf("B", 6)}},
+			kind: RequirementAll,
+		},
+		{
+			name: "resolved credit points show every child is needed",
+			node: &RequirementNode{Kind: RequirementChoose, MinCreditPoints: 24, Children: []*RequirementNode{unitLeaf("A", 12), unitLeaf("B", 12)}},
+			kind: RequirementAll,
+		},
+		{
+			name: "nested containers count their own minimum",
+			node: &RequirementNode{Kind: RequirementAll, MinCreditPoints: 12, Children: []*RequirementNode{
+				{Kind: RequirementChoose, MinCreditPoints: 6, Children: []*RequirementNode{unitLeaf("A", 6), unitLeaf("B", 6)}},
+				unitLeaf("C", 6),
+			}},
+			kind: RequirementAll,
+		},
+		{
+			name:   "a counted choice is left alone",
+			node:   &RequirementNode{Kind: RequirementChoose, Choose: 1, MinCreditPoints: 6, Children: []*RequirementNode{unitLeaf("A", 6), unitLeaf("B", 6)}},
+			kind:   RequirementChoose,
+			choose: 1,
+		},
+		{
+			name: "no minimum",
+			node: &RequirementNode{Kind: RequirementAll, Children: []*RequirementNode{unitLeaf("A", 6), unitLeaf("B", 6)}},
+			kind: RequirementAll,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chooseByCreditPoints(test.node)
+			if test.node.Kind != test.kind || test.node.Choose != test.choose {
+				t.Errorf("got %s choose %d, want %s choose %d", test.node.Kind, test.node.Choose, test.kind, test.choose)
+			}
+		})
+	}
+}
+
+func TestAttainableCreditPoints(t *testing.T) {
+	tests := []struct {
+		name string
+		node *RequirementNode
+		want int
+	}{
+		{"unresolved unit", &RequirementNode{Kind: RequirementUnit, Code: "A"}, DefaultUnitCreditPoints},
+		{"unresolved AOS", &RequirementNode{Kind: RequirementAOS, Code: "COMPSCI01"}, 0},
+		{"all children", &RequirementNode{Kind: RequirementAll, Children: []*RequirementNode{unitLeaf("A", 6), unitLeaf("B", 12)}}, 18},
+		{"choose the largest", &RequirementNode{Kind: RequirementChoose, Choose: 2, Children: []*RequirementNode{unitLeaf("A", 6), unitLeaf("B", 12), unitLeaf("C", 24)}}, 36},
+		{"chosen by credit points", &RequirementNode{Kind: RequirementChoose, MinCreditPoints: 12, Children: []*RequirementNode{unitLeaf("A", 6), unitLeaf("B", 6), unitLeaf("C", 6)}}, 18},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := AttainableCreditPoints(test.node); got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckRequirements(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     *RequirementNode
+		problems []string
+	}{
+		{
+			name:     "enough credit points",
+			node:     &RequirementNode{Kind: RequirementAll, Title: "Core", MinCreditPoints: 12, Children: []*RequirementNode{unitLeaf("A", 6), unitLeaf("B", 6)}},
+			problems: []string{},
+		},
+		{
+			name:     "too few credit points",
+			node:     &RequirementNode{Kind: RequirementAll, Title: "Core", MinCreditPoints: 24, Children: []*RequirementNode{unitLeaf("A", 6), unitLeaf("B", 6)}},
+			problems: []string{"requires 24 credit points but children provide at most 12"},
+		},
+		{
+			name:     "choose more than there are options",
+			node:     &RequirementNode{Kind: RequirementChoose, Title: "Electives", Choose: 3, Children: []*RequirementNode{unitLeaf("A", 6), unitLeaf("B", 6)}},
+			problems: []string{"choose 3 but only 2 options"},
+		},
+		{
+			name:     "unknown credit points are skipped",
+			node:     &RequirementNode{Kind: RequirementAll, Title: "Major", MinCreditPoints: 48, Children: []*RequirementNode{{Kind: RequirementAOS, Code: "COMPSCI01"}}},
+			problems: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems := make([]string, 0)
+			for _, issue := range CheckRequirements("C2001", test.node) {
+				problems = append(problems, issue.Problem)
+			}
+			if !reflect.DeepEqual(problems, test.problems) {
+				t.Errorf("got %v, want %v", problems, test.problems)
+			}
+		})
+	}
+}
+
+// Records read back from the store hold their requirements as plain maps, not *RequirementNode.
+func TestValidateRequirementsDecodedRecords(t *testing.T) {
+	tree := &RequirementNode{Kind: RequirementAll, Title: "Core", MinCreditPoints: 24, Children: []*RequirementNode{
+		{Kind: RequirementUnit, Code: "FIT1045"},
+		{Kind: RequirementUnit, Code: "FIT9999"},
+	}}
+	data, err := json.Marshal(map[string]interface{}{
+		"C2001": map[string]interface{}{"requirements": tree},
+		"C2002": map[string]interface{}{"requirements": "not a tree"},
+		"C2003": map[string]interface{}{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var formatted map[string]interface{}
+	if err := json.Unmarshal(data, &formatted); err != nil {
+		t.Fatal(err)
+	}
+	units := map[string]interface{}{"FIT1045": map[string]interface{}{"credit_points": float64(6)}}
+
+	issues := ValidateRequirements(formatted, units, map[string]interface{}{})
+	want := []RequirementIssue{
+		{Item: "C2001", Node: "FIT9999", Problem: "no unit or AOS record"},
+		{Item: "C2001", Node: "Core", Problem: "requires 24 credit points but children provide at most 12"},
+	}
+	if len(issues) != 3 || !reflect.DeepEqual(issues[:2], want) || issues[2].Item != "C2002" {
+		t.Errorf("got %+v, want %+v and an unreadable C2002", issues, want)
+	}
+}
@@ -1,5 +1,7 @@
 package format
 
+import "handbook-scraper/codes"
+
 type StructureElement struct {
 	Title           string             `json:"title"`
 	Description     string             `json:"description,omitempty"`
@@ -14,7 +16,7 @@ func getMonashStructure(structure *[]StructureElement, currContainer []map[strin
 		newElement := StructureElement{
 			Title:        element["title"].(string),
 			Description:  element["description"].(string),
-			CreditPoints: parseInt(element["credit_points"]),
+			CreditPoints: codes.ParseInt(element["credit_points"]),
 			Courses:      make(map[string]string),
 			Structure:    []StructureElement{},
 		}
@@ -30,7 +32,8 @@ func getMonashStructure(structure *[]StructureElement, currContainer []map[strin
 			for _, course := range relationship {
 				if courseMap, ok := course.(map[string]interface{}); ok {
 					if academicItemCode, ok := courseMap["academic_item_code"].(string); ok {
-						newElement.Courses[academicItemCode] = courseMap["academic_item_name"].(string)
+						name, _ := courseMap["academic_item_name"].(string)
+						newElement.Courses[academicItemCode] = name
 					}
 				}
 			}
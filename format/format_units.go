@@ -1,53 +1,99 @@
 package format
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
-	"regexp"
+	"handbook-scraper/codes"
 	"strconv"
 	"strings"
 )
 
-var unitPattern = regexp.MustCompile(`[A-Z]{3}[0-9]{4}`)
-
-func pullHandbookRequisites(handbookDict map[string]interface{}) map[string]bool {
-	prohibitions := make(map[string]bool)
+// HandbookRequisites are the units named in a unit's handbook requisite boxes, by box type.
+type HandbookRequisites struct {
+	Prerequisites []string `json:"prerequisites"`
+	Corequisites  []string `json:"corequisites"`
+	Prohibitions  []string `json:"prohibitions"`
+}
 
-	if manualRules, exists := handbookDict["enrolment_rules"]; exists {
+// containerUnits walks a requisite container and its nested containers for the unit codes of its relationships.
+func containerUnits(container map[string]interface{}, found map[string]bool) {
+	if relationships, ok := container["relationships"].([]interface{}); ok {
+		for _, unitSpec := range relationships {
+			spec, _ := unitSpec.(map[string]interface{})
+			item, _ := spec["academic_item"].(map[string]interface{})
+			value, _ := item["value"].(string)
+			for _, code := range codes.Extract(value) {
+				found[code] = true
+			}
+		}
+	}
+	if nested, ok := container["containers"].([]interface{}); ok {
+		for _, child := range nested {
+			if childMap, ok := child.(map[string]interface{}); ok {
+				containerUnits(childMap, found)
+			}
+		}
+	}
+}
 
-		for _, rule := range manualRules.([]interface{}) {
-			description := rule.(map[string]interface{})["description"]
-			if strings.Contains(strings.ToUpper(description.(string)), "PROHIBITION") {
+// pullRequisiteBoxes reads the prerequisite, corequisite and prohibition boxes of a raw unit.
+func pullRequisiteBoxes(handbookDict map[string]interface{}) map[string]map[string]bool {
+	boxes := map[string]map[string]bool{
+		"prerequisites": make(map[string]bool),
+		"corequisites":  make(map[string]bool),
+		"prohibitions":  make(map[string]bool),
+	}
 
-				matches := unitPattern.FindAllString(description.(string), -1)
-				for _, match := range matches {
-					prohibitions[match] = true
-				}
+	boxedRules, _ := handbookDict["requisites"].([]interface{})
+	for _, ruleBox := range boxedRules {
+		box, _ := ruleBox.(map[string]interface{})
+		requisiteType, _ := box["requisite_type"].(map[string]interface{})
+		ruleType, _ := requisiteType["value"].(string)
+		found, ok := boxes[strings.ToLower(ruleType)]
+		if !ok {
+			continue
+		}
+		containers, _ := box["container"].([]interface{})
+		for _, container := range containers {
+			if containerMap, ok := container.(map[string]interface{}); ok {
+				containerUnits(containerMap, found)
 			}
 		}
+		code, _ := handbookDict["code"].(string)
+		delete(found, code)
 	}
 
-	if boxedRules, exists := handbookDict["requisites"]; exists {
-		for _, ruleBox := range boxedRules.([]interface{}) {
-			switch ruleType := ruleBox.(map[string]interface{})["requisite_type"].(map[string]interface{})["value"].(string); ruleType {
-			case "prohibitions":
-				container := ruleBox.(map[string]interface{})["container"].([]interface{})
-				// Check if container is not empty before accessing [0]
-				if len(container) > 0 {
-					relationships := container[0].(map[string]interface{})["relationships"].([]interface{})
-					for _, unitSpec := range relationships {
-						unitValue := strings.Fields(unitSpec.(map[string]interface{})["academic_item"].(map[string]interface{})["value"].(string))[1]
-						prohibitions[unitValue] = true
-					}
-				}
+	return boxes
+}
+
+// pullHandbookRequisites collects prohibited units from a unit's classified enrolment rules and requisite boxes.
+func pullHandbookRequisites(handbookDict map[string]interface{}, constraints []EnrolmentConstraint) map[string]bool {
+	prohibitions := make(map[string]bool)
+
+	for _, constraint := range constraints {
+		if constraint.Kind == ConstraintProhibition {
+			for _, match := range constraint.Units {
+				prohibitions[match] = true
 			}
 		}
 	}
 
+	for unit := range pullRequisiteBoxes(handbookDict)["prohibitions"] {
+		prohibitions[unit] = true
+	}
+
 	return prohibitions
 }
 
+// handbookRequisites gathers everything the handbook says about a unit's requisites.
+func handbookRequisites(handbookDict map[string]interface{}, constraints []EnrolmentConstraint) HandbookRequisites {
+	boxes := pullRequisiteBoxes(handbookDict)
+	return HandbookRequisites{
+		Prerequisites: codes.Sorted(boxes["prerequisites"]),
+		Corequisites:  codes.Sorted(boxes["corequisites"]),
+		Prohibitions:  codes.Sorted(pullHandbookRequisites(handbookDict, constraints)),
+	}
+}
+
 func formatOffering(data interface{}) map[string]interface{} {
 	offering, ok := data.(map[string]interface{})
 	if !ok {
@@ -56,9 +102,9 @@ func formatOffering(data interface{}) map[string]interface{} {
 
 	return map[string]interface{}{
 		"name":     offering["display_name"],
-		"location": offering["location"].(map[string]interface{})["value"],
-		"mode":     offering["attendance_mode"].(map[string]interface{})["value"],
-		"period":   offering["teaching_period"].(map[string]interface{})["value"],
+		"location": nestedField(offering, "location", "value"),
+		"mode":     nestedField(offering, "attendance_mode", "value"),
+		"period":   nestedField(offering, "teaching_period", "value"),
 	}
 }
 
@@ -75,10 +121,10 @@ func getOfferings(raw_offerings []interface{}) []map[string]interface{} {
 }
 
 func possiblyExam(assessment map[string]interface{}) string {
-	var name = assessment["assessment_name"].(string)
-	var examType = assessment["assessment_type"].(map[string]interface{})["value"]
+	name, _ := assessment["assessment_name"].(string)
+	examType, _ := nestedField(assessment, "assessment_type", "value").(string)
 
-	if examType == nil {
+	if examType == "" {
 		nameLower := strings.ToLower(name)
 
 		if strings.Contains(nameLower, "exam") || strings.Contains(nameLower, strings.ToLower("Scheduled final assessment")) {
@@ -99,7 +145,7 @@ func possiblyExam(assessment map[string]interface{}) string {
 
 		return "unknown"
 	}
-	return examType.(string)
+	return examType
 }
 
 func formatAssessment(raw_assessment interface{}) map[string]interface{} {
@@ -109,8 +155,9 @@ func formatAssessment(raw_assessment interface{}) map[string]interface{} {
 		return nil
 	}
 
+	name, _ := assessment["assessment_name"].(string)
 	return map[string]interface{}{
-		"name": assessment["assessment_name"].(string),
+		"name": name,
 		"type": possiblyExam(assessment),
 	}
 }
@@ -163,67 +210,123 @@ func extractLastDigit(s string) int {
 	return 0
 }
 
-func FormatUnit(raw_unit map[string]interface{}) map[string]interface{} {
+// listField reads raw[key] as a list. A missing list is empty; anything else is an error.
+func listField(raw map[string]interface{}, key string) ([]interface{}, error) {
+	switch value := raw[key].(type) {
+	case []interface{}:
+		return value, nil
+	case nil:
+		return make([]interface{}, 0), nil
+	default:
+		return nil, fmt.Errorf("%s is not a list", key)
+	}
+}
+
+// FormatUnit formats one scraped unit. Missing fields are left empty;
+// fields of the wrong shape are an error.
+func FormatUnit(raw_unit map[string]interface{}) (map[string]interface{}, error) {
+	raw_offerings, err := listField(raw_unit, "unit_offering")
+	if err != nil {
+		return nil, err
+	}
+	raw_assessments, err := listField(raw_unit, "assessments")
+	if err != nil {
+		return nil, err
+	}
+
 	return map[string]interface{}{
 		"title":         raw_unit["title"],
 		"code":          raw_unit["code"],
 		"credit_points": raw_unit["credit_points"],
 		"level": func() int {
-			if code, ok := raw_unit["code"].(string); ok && len(code) >= 4 {
-				if num, err := strconv.Atoi(string(code[3])); err == nil {
-					return num
-				}
-			}
-			return 0
+			code, _ := raw_unit["code"].(string)
+			return codes.Level(code)
 		}(),
 		"sca_band":     ExtractSCABand(raw_unit),
-		"academic_org": raw_unit["academic_org"].(map[string]interface{})["value"],
-		"school":       raw_unit["school"].(map[string]interface{})["value"],
-		"offerings":    getOfferings(raw_unit["unit_offering"].([]interface{})),
-		"assessments":  getAssessments((raw_unit["assessments"].([]interface{}))),
-	}
+		"academic_org": nestedField(raw_unit, "academic_org", "value"),
+		"school":       nestedField(raw_unit, "school", "value"),
+		"offerings":    getOfferings(raw_offerings),
+		"assessments":  getAssessments(raw_assessments),
+	}, nil
 	// Add in enrolment rules and requisites here
 }
 
 // raw_unit["level"].(map[string]interface{})["value"],
-// Generates two artefacts, one is IO'd
-// Returns: (formatted_unit_data, detected_year)
-func FormatUnits(raw_units []map[string]interface{}) (map[string]interface{}, string) {
+
+// FormattedUnits is the result of formatting the scraped units.
+type FormattedUnits struct {
+	// Units are the formatted units by code
+	Units map[string]interface{}
+	// DetectedYear is the implementation year named by the units, or the fallback year
+	DetectedYear string
+	// ProhibitionCandidates are each unit followed by the units the handbook says it prohibits
+	ProhibitionCandidates [][]string
+	// EquivalentUnitGroups merge the overlapping prohibition candidates
+	EquivalentUnitGroups [][]string
+	UnknownCodes         []codes.UnknownCodes
+	UnclassifiedRules    []UnclassifiedRule
+	// Malformed are the scraped units that could not be formatted and were left out
+	Malformed []MalformedUnit
+}
+
+// MalformedUnit is a scraped unit whose page did not have the expected shape.
+type MalformedUnit struct {
+	Unit  string `json:"unit"`
+	Error string `json:"error"`
+}
+
+// FormatUnits formats the scraped units.
+// Rule text codes are validated against the index; a nil index accepts any well formed code.
+// fallbackYear is reported when no unit names its implementation year.
+func FormatUnits(raw_units []map[string]interface{}, index *codes.Index, fallbackYear int) *FormattedUnits {
 
 	var formatted_unit_data = make(map[string]interface{})
-	var prohibition_candidates [][]string
+	var prohibition_candidates = make([][]string, 0)
+	var unknown_codes = make([]codes.UnknownCodes, 0)
+	var unclassified_rules = make([]UnclassifiedRule, 0)
 
 	// Extract implementation year from first unit with the field
-	var detectedYear string = "2024" // Default fallback
+	var detectedYear string = strconv.Itoa(fallbackYear)
 	for _, unit := range raw_units {
 		if implYear, ok := unit["implementation_year"].(string); ok && implYear != "" {
 			detectedYear = implYear
-			fmt.Printf("Detected implementation year: %s\n", detectedYear)
 			break
 		}
 	}
 
+	var malformed = make([]MalformedUnit, 0)
 	for _, unit := range raw_units {
 		code, ok := unit["code"].(string)
 		if !ok {
 			continue
 		}
-		formatted_unit_data[code] = FormatUnit(unit)
-
+		formatted, err := FormatUnit(unit)
+		if err != nil {
+			malformed = append(malformed, MalformedUnit{Unit: code, Error: err.Error()})
+			continue
+		}
+		formatted_unit_data[code] = formatted
 	}
 
 	for _, unit := range raw_units {
-		code, ok := unit["code"].(string)
+		code, _ := unit["code"].(string)
+		formatted, ok := formatted_unit_data[code].(map[string]interface{})
 		if !ok {
 			continue
 		}
-		prelim_candidate := pullHandbookRequisites(unit)
+		constraints, unclassified, unknown := classifyUnitRules(unit, index)
+		formatted["enrolment_rules"] = constraints
+		formatted["handbook_requisites"] = handbookRequisites(unit, constraints)
+		unclassified_rules = append(unclassified_rules, unclassified...)
+		unknown_codes = append(unknown_codes, unknown...)
+
+		prelim_candidate := pullHandbookRequisites(unit, constraints)
 		var prohibition_candidate = make([]string, 0)
 		prohibition_candidate = append(prohibition_candidate, code)
 
-		// Get only existing units
+		// Get only existing units, other than the unit itself
 		for candidate := range prelim_candidate {
-			if _, ok := formatted_unit_data[candidate]; ok {
+			if _, ok := formatted_unit_data[candidate]; ok && candidate != code {
 				prohibition_candidate = append(prohibition_candidate, candidate)
 			}
 		}
@@ -232,15 +335,15 @@ func FormatUnits(raw_units []map[string]interface{}) (map[string]interface{}, st
 		}
 	}
 
-	data, err := json.Marshal(prohibition_candidates)
-
-	if err != nil {
-		fmt.Println("Encountered an error with prohibition JSON marshalling:", err)
+	codes.SortUnknown(unknown_codes)
+	return &FormattedUnits{
+		Units:                 formatted_unit_data,
+		DetectedYear:          detectedYear,
+		ProhibitionCandidates: prohibition_candidates,
+		EquivalentUnitGroups:  EquivalentUnitGroups(prohibition_candidates),
+		UnknownCodes:          unknown_codes,
+		UnclassifiedRules:     unclassified_rules,
+		Malformed:             malformed,
 	}
-	if err := os.WriteFile("data/prohibition_candidates.json", data, 0644); err != nil {
-		fmt.Println("Encountered an error writing:", err)
-	}
-
-	return formatted_unit_data, detectedYear
 
 }
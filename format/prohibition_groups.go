@@ -0,0 +1,132 @@
+package format
+
+import (
+	"handbook-scraper/codes"
+	"sort"
+	"strings"
+)
+
+// Groups overlapping prohibition candidate lists into equivalence classes with union-find.
+// Families like ACB/ACC/ACF/ACW/ACX prohibit one another in many overlapping lists; each
+// class only needs to be probed against MonPlan once, with all of its members in one plan.
+// Chaining can merge whole faculties into one class, so classes over MaxGroupSize are split
+// back into their candidate lists, packed into groups no larger than the cap.
+
+// MaxGroupSize is the most units a group puts into one MonPlan probe. Candidate lists are
+// rarely above a dozen units, so only classes built by chaining are split.
+const MaxGroupSize = 16
+
+type unionFind struct {
+	parent map[string]string
+	rank   map[string]int
+}
+
+func newUnionFind() *unionFind {
+	return &unionFind{parent: make(map[string]string), rank: make(map[string]int)}
+}
+
+func (uf *unionFind) find(item string) string {
+	if _, ok := uf.parent[item]; !ok {
+		uf.parent[item] = item
+	}
+	for uf.parent[item] != item {
+		// Path halving keeps the trees shallow
+		uf.parent[item] = uf.parent[uf.parent[item]]
+		item = uf.parent[item]
+	}
+	return item
+}
+
+func (uf *unionFind) union(a string, b string) {
+	rootA, rootB := uf.find(a), uf.find(b)
+	if rootA == rootB {
+		return
+	}
+	switch {
+	case uf.rank[rootA] < uf.rank[rootB]:
+		uf.parent[rootA] = rootB
+	case uf.rank[rootA] > uf.rank[rootB]:
+		uf.parent[rootB] = rootA
+	default:
+		uf.parent[rootB] = rootA
+		uf.rank[rootA]++
+	}
+}
+
+// packCandidates splits an oversized class into groups of at most MaxGroupSize units.
+// Each candidate list stays whole so every pair it names is still probed together;
+// a single list over the cap becomes a group of its own.
+func packCandidates(candidates [][]string) []map[string]bool {
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i][0] < candidates[j][0]
+	})
+
+	groups := make([]map[string]bool, 0)
+	current := make(map[string]bool)
+	for _, candidate := range candidates {
+		added := 0
+		for _, unit := range candidate {
+			if !current[unit] {
+				added++
+			}
+		}
+		if len(current) > 0 && len(current)+added > MaxGroupSize {
+			groups = append(groups, current)
+			current = make(map[string]bool)
+		}
+		for _, unit := range candidate {
+			current[unit] = true
+		}
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+// EquivalentUnitGroups merges prohibition candidate lists that share a unit, splitting
+// classes over MaxGroupSize. Each group is sorted and free of duplicates; groups are
+// ordered by their units.
+func EquivalentUnitGroups(candidates [][]string) [][]string {
+	uf := newUnionFind()
+	for _, candidate := range candidates {
+		for _, unit := range candidate {
+			uf.union(candidate[0], unit)
+		}
+	}
+
+	byRoot := make(map[string][][]string)
+	for _, candidate := range candidates {
+		if len(candidate) > 0 {
+			root := uf.find(candidate[0])
+			byRoot[root] = append(byRoot[root], candidate)
+		}
+	}
+
+	members := make(map[string]map[string]bool)
+	for unit := range uf.parent {
+		root := uf.find(unit)
+		if members[root] == nil {
+			members[root] = make(map[string]bool)
+		}
+		members[root][unit] = true
+	}
+
+	groups := make([][]string, 0, len(members))
+	for root, set := range members {
+		sets := []map[string]bool{set}
+		if len(set) > MaxGroupSize {
+			sets = packCandidates(byRoot[root])
+		}
+		for _, set := range sets {
+			if len(set) > 1 {
+				groups = append(groups, codes.Sorted(set))
+			}
+		}
+	}
+	// Split classes can share a first unit, so ties go to the rest of the group
+	sort.Slice(groups, func(i, j int) bool {
+		return strings.Join(groups[i], ",") < strings.Join(groups[j], ",")
+	})
+	return groups
+}
@@ -0,0 +1,81 @@
+package format
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestEquivalentUnitGroups(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates [][]string
+		want       [][]string
+	}{
+		{
+			name:       "duplicates within a list",
+			candidates: [][]string{{"ASP1010", "ASP1010", "ASP2011", "ASP2062"}},
+			want:       [][]string{{"ASP1010", "ASP2011", "ASP2062"}},
+		},
+		{
+			name: "overlapping lists merged",
+			candidates: [][]string{
+				{"ASP1010", "ASP1010", "ASP2011"},
+				{"ASP2011", "ASP2062"},
+				{"ACB1020", "ACC1100"},
+				{"ACC1100", "ACF1100"},
+			},
+			want: [][]string{{"ACB1020", "ACC1100", "ACF1100"}, {"ASP1010", "ASP2011", "ASP2062"}},
+		},
+		{
+			name:       "single units dropped",
+			candidates: [][]string{{"BPS1042", "BPS1042"}, {"ETX5441"}},
+			want:       [][]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := EquivalentUnitGroups(test.candidates); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// A chain of overlapping lists forms one class far over the cap.
+func TestEquivalentUnitGroupsSplitsLargeClasses(t *testing.T) {
+	candidates := make([][]string, 0)
+	for idx := 0; idx < 40; idx++ {
+		candidates = append(candidates, []string{fmt.Sprintf("ACC1%03d", idx), fmt.Sprintf("ACC1%03d", idx+1), fmt.Sprintf("ACF1%03d", idx)})
+	}
+
+	groups := EquivalentUnitGroups(candidates)
+	if len(groups) < 2 {
+		t.Fatalf("got %d groups, want the class split", len(groups))
+	}
+	for _, group := range groups {
+		if len(group) > MaxGroupSize {
+			t.Errorf("group of %d units is over the cap of %d", len(group), MaxGroupSize)
+		}
+	}
+
+	// Every candidate list must still be probed within one group
+	for _, candidate := range candidates {
+		covered := false
+		for _, group := range groups {
+			members := make(map[string]bool)
+			for _, unit := range group {
+				members[unit] = true
+			}
+			all := true
+			for _, unit := range candidate {
+				all = all && members[unit]
+			}
+			covered = covered || all
+		}
+		if !covered {
+			t.Errorf("candidate %v is not within any group", candidate)
+		}
+	}
+}
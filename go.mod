@@ -1,3 +1,8 @@
 module handbook-scraper
 
 go 1.21.3
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.22
+	gopkg.in/yaml.v3 v3.0.1
+)
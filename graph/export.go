@@ -0,0 +1,199 @@
+package graph
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Writers for Graphviz DOT, GraphML and Mermaid.
+// Prerequisites are solid, corequisites dashed and prohibitions dotted and undirected.
+
+type edgeStyle struct {
+	dot       string
+	mermaid   string
+	colour    string
+	linkStyle string
+}
+
+var edgeStyles = map[EdgeKind]edgeStyle{
+	Prerequisite: {dot: `color="#37474f"`, mermaid: "-->", colour: "#37474f", linkStyle: "stroke:#37474f"},
+	Corequisite:  {dot: `color="#1e88e5", style=dashed`, mermaid: "-.->", colour: "#1e88e5", linkStyle: "stroke:#1e88e5"},
+	Prohibition:  {dot: `color="#e53935", style=dotted, dir=none`, mermaid: "x--x", colour: "#e53935", linkStyle: "stroke:#e53935,stroke-dasharray:3 3"},
+}
+
+// Formats lists the names accepted by Write.
+var Formats = []string{"dot", "graphml", "mermaid"}
+
+// Write renders the graph in the named format.
+func Write(w io.Writer, g *Graph, format string) error {
+	switch strings.ToLower(format) {
+	case "dot":
+		return WriteDOT(w, g)
+	case "graphml":
+		return WriteGraphML(w, g)
+	case "mermaid", "mmd":
+		return WriteMermaid(w, g)
+	}
+	return fmt.Errorf("unknown graph format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+func nodeLabel(node *Node) string {
+	if node.Title == "" {
+		return node.Code
+	}
+	return node.Code + "\n" + node.Title
+}
+
+func WriteDOT(w io.Writer, g *Graph) error {
+	var builder strings.Builder
+	builder.WriteString("digraph requisites {\n")
+	builder.WriteString("  rankdir=LR;\n")
+	builder.WriteString("  node [shape=box, style=\"rounded,filled\", fillcolor=\"#fff9c4\", fontname=\"Helvetica\"];\n")
+
+	for _, code := range g.SortedCodes() {
+		node := g.Nodes[code]
+		attributes := fmt.Sprintf("label=%q", nodeLabel(node))
+		if node.External {
+			attributes += `, fillcolor="#eeeeee"`
+		}
+		fmt.Fprintf(&builder, "  %q [%s];\n", code, attributes)
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&builder, "  %q -> %q [%s];\n", edge.From, edge.To, edgeStyles[edge.Kind].dot)
+	}
+
+	builder.WriteString("}\n")
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	Name     string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+// WriteGraphML writes the graph with title, school and external flags on nodes,
+// and kind, colour and directedness on edges.
+func WriteGraphML(w io.Writer, g *Graph) error {
+	document := graphMLDocument{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "title", For: "node", Name: "title", AttrType: "string"},
+			{ID: "school", For: "node", Name: "school", AttrType: "string"},
+			{ID: "external", For: "node", Name: "external", AttrType: "boolean"},
+			{ID: "kind", For: "edge", Name: "kind", AttrType: "string"},
+			{ID: "colour", For: "edge", Name: "colour", AttrType: "string"},
+			{ID: "directed", For: "edge", Name: "directed", AttrType: "boolean"},
+		},
+	}
+	document.Graph.ID = "requisites"
+	document.Graph.EdgeDefault = "directed"
+
+	for _, code := range g.SortedCodes() {
+		node := g.Nodes[code]
+		document.Graph.Nodes = append(document.Graph.Nodes, graphMLNode{
+			ID: code,
+			Data: []graphMLData{
+				{Key: "title", Value: node.Title},
+				{Key: "school", Value: node.School},
+				{Key: "external", Value: fmt.Sprint(node.External)},
+			},
+		})
+	}
+	for idx, edge := range g.Edges {
+		document.Graph.Edges = append(document.Graph.Edges, graphMLEdge{
+			ID:     fmt.Sprintf("e%d", idx),
+			Source: edge.From,
+			Target: edge.To,
+			Data: []graphMLData{
+				{Key: "kind", Value: string(edge.Kind)},
+				{Key: "colour", Value: edgeStyles[edge.Kind].colour},
+				{Key: "directed", Value: fmt.Sprint(edge.Kind != Prohibition)},
+			},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// mermaidLabel escapes a title for use inside a quoted Mermaid label.
+func mermaidLabel(node *Node) string {
+	label := node.Code
+	if node.Title != "" {
+		label += "<br/>" + node.Title
+	}
+	return strings.ReplaceAll(label, `"`, "#quot;")
+}
+
+// WriteMermaid writes a flowchart in the same style as the diagrams in docs/.
+func WriteMermaid(w io.Writer, g *Graph) error {
+	var builder strings.Builder
+	builder.WriteString("graph LR\n")
+
+	for _, code := range g.SortedCodes() {
+		fmt.Fprintf(&builder, "    %s[\"%s\"]\n", code, mermaidLabel(g.Nodes[code]))
+	}
+	builder.WriteString("\n")
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&builder, "    %s %s %s\n", edge.From, edgeStyles[edge.Kind].mermaid, edge.To)
+	}
+
+	if len(g.Edges) > 0 {
+		builder.WriteString("\n")
+	}
+	for idx, edge := range g.Edges {
+		fmt.Fprintf(&builder, "    linkStyle %d %s\n", idx, edgeStyles[edge.Kind].linkStyle)
+	}
+	for _, code := range g.SortedCodes() {
+		fill := "#fff9c4"
+		if g.Nodes[code].External {
+			fill = "#eeeeee"
+		}
+		fmt.Fprintf(&builder, "    style %s fill:%s\n", code, fill)
+	}
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
@@ -0,0 +1,172 @@
+// Builds the requisite graph between processed units.
+// Prerequisite and corequisite edges point from the requisite to the unit it unlocks;
+// prohibition edges are undirected and stored once per pair.
+
+package graph
+
+import (
+	"fmt"
+	"handbook-scraper/process"
+	"sort"
+	"strings"
+)
+
+type EdgeKind string
+
+const (
+	Prerequisite EdgeKind = "prerequisite"
+	Corequisite  EdgeKind = "corequisite"
+	Prohibition  EdgeKind = "prohibition"
+)
+
+type Node struct {
+	Code     string `json:"code"`
+	Title    string `json:"title"`
+	School   string `json:"school"`
+	External bool   `json:"external,omitempty"`
+}
+
+type Edge struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Kind EdgeKind `json:"kind"`
+}
+
+type Graph struct {
+	Nodes map[string]*Node
+	Edges []Edge
+}
+
+// FromProcessed builds the full requisite graph from processed units.
+// Units named in requisites but missing from the processed file become bare nodes.
+func FromProcessed(units map[string]*process.ProcessedUnit) *Graph {
+	g := &Graph{Nodes: make(map[string]*Node)}
+	for code, unit := range units {
+		g.Nodes[code] = &Node{Code: code, Title: unit.Title, School: unit.School}
+	}
+
+	seenProhibitions := make(map[[2]string]bool)
+	for code, unit := range units {
+		for _, requisite := range unit.PrerequisiteUnits() {
+			g.addEdge(requisite, code, Prerequisite)
+		}
+		for _, requisite := range unit.CorequisiteUnits() {
+			g.addEdge(requisite, code, Corequisite)
+		}
+		for _, prohibited := range unit.ProhibitedUnits() {
+			pair := [2]string{code, prohibited}
+			if prohibited < code {
+				pair = [2]string{prohibited, code}
+			}
+			if pair[0] != pair[1] && !seenProhibitions[pair] {
+				seenProhibitions[pair] = true
+				g.addEdge(pair[0], pair[1], Prohibition)
+			}
+		}
+	}
+
+	g.sortEdges()
+	return g
+}
+
+func (g *Graph) addEdge(from string, to string, kind EdgeKind) {
+	for _, code := range []string{from, to} {
+		if _, ok := g.Nodes[code]; !ok {
+			g.Nodes[code] = &Node{Code: code}
+		}
+	}
+	g.Edges = append(g.Edges, Edge{From: from, To: to, Kind: kind})
+}
+
+func (g *Graph) sortEdges() {
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		if g.Edges[i].To != g.Edges[j].To {
+			return g.Edges[i].To < g.Edges[j].To
+		}
+		return g.Edges[i].Kind < g.Edges[j].Kind
+	})
+}
+
+// SortedCodes returns node codes in a stable order for writers.
+func (g *Graph) SortedCodes() []string {
+	codes := make([]string, 0, len(g.Nodes))
+	for code := range g.Nodes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// subgraph keeps the edges whose endpoints are both in keep.
+// Nodes outside inside are marked external so writers can style them apart.
+func (g *Graph) subgraph(keep map[string]bool, inside map[string]bool) *Graph {
+	sub := &Graph{Nodes: make(map[string]*Node)}
+	for code := range keep {
+		node := *g.Nodes[code]
+		node.External = !inside[code]
+		sub.Nodes[code] = &node
+	}
+	for _, edge := range g.Edges {
+		if keep[edge.From] && keep[edge.To] {
+			sub.Edges = append(sub.Edges, edge)
+		}
+	}
+	return sub
+}
+
+// Faculty keeps the units whose school or academic org matches the given name (case insensitive),
+// along with the units outside it that they are directly connected to.
+func (g *Graph) Faculty(name string, units map[string]*process.ProcessedUnit) *Graph {
+	name = strings.ToLower(name)
+	inside := make(map[string]bool)
+	for code, unit := range units {
+		if strings.Contains(strings.ToLower(unit.School), name) || strings.Contains(strings.ToLower(unit.AcademicOrg), name) {
+			inside[code] = true
+		}
+	}
+
+	keep := make(map[string]bool)
+	for code := range inside {
+		keep[code] = true
+	}
+	for _, edge := range g.Edges {
+		if inside[edge.From] || inside[edge.To] {
+			keep[edge.From] = true
+			keep[edge.To] = true
+		}
+	}
+	return g.subgraph(keep, inside)
+}
+
+// Ego keeps every unit within hops edges of the centre, ignoring edge direction.
+// Fails when the centre is not in the graph, rather than returning an empty one.
+func (g *Graph) Ego(centre string, hops int) (*Graph, error) {
+	if _, ok := g.Nodes[centre]; !ok {
+		return nil, fmt.Errorf("unit %s is not in the graph", centre)
+	}
+
+	adjacent := make(map[string][]string)
+	for _, edge := range g.Edges {
+		adjacent[edge.From] = append(adjacent[edge.From], edge.To)
+		adjacent[edge.To] = append(adjacent[edge.To], edge.From)
+	}
+
+	keep := map[string]bool{centre: true}
+	frontier := []string{centre}
+	for hop := 0; hop < hops && len(frontier) > 0; hop++ {
+		next := make([]string, 0)
+		for _, code := range frontier {
+			for _, neighbour := range adjacent[code] {
+				if !keep[neighbour] {
+					keep[neighbour] = true
+					next = append(next, neighbour)
+				}
+			}
+		}
+		frontier = next
+	}
+	return g.subgraph(keep, keep), nil
+}
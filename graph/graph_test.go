@@ -0,0 +1,114 @@
+package graph
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"handbook-scraper/process"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// sampleUnits: FIT2004 needs FIT1008 or MAT1830 (not in the processed units), FIT2014 is taken
+// alongside FIT2004, FIT1053 prohibits FIT1045 and ENG1005 sits in another faculty.
+func sampleUnits() map[string]*process.ProcessedUnit {
+	unit := func(code string, title string, school string) *process.ProcessedUnit {
+		return &process.ProcessedUnit{Code: code, Title: title, School: school, Requisites: &process.RefinedRequisite{}}
+	}
+	units := map[string]*process.ProcessedUnit{
+		"FIT1008": unit("FIT1008", "Introduction to computer science", "Faculty of Information Technology"),
+		"FIT2004": unit("FIT2004", "Algorithms and data structures", "Faculty of Information Technology"),
+		"FIT2014": unit("FIT2014", `Theory of "computation"`, "Faculty of Information Technology"),
+		"FIT1045": unit("FIT1045", "Introduction to programming", "Faculty of Information Technology"),
+		"FIT1053": unit("FIT1053", "Algorithms and programming in Python (Advanced)", "Faculty of Information Technology"),
+		"ENG1005": unit("ENG1005", "Engineering mathematics", "Faculty of Engineering"),
+	}
+	units["FIT2004"].Requisites.PrerequisiteTree = process.OrNode(process.UnitNode("FIT1008"), process.UnitNode("MAT1830"))
+	units["FIT2014"].Requisites.CorequisiteTree = process.UnitNode("FIT2004")
+	units["FIT1053"].Requisites.Prohibitions = []string{"FIT1045"}
+	units["FIT1045"].Requisites.PrerequisiteTree = process.UnitNode("ENG1005")
+	return units
+}
+
+func TestWriters(t *testing.T) {
+	g := FromProcessed(sampleUnits())
+
+	for _, name := range []string{"requisites.dot", "requisites.graphml", "requisites.mmd"} {
+		t.Run(name, func(t *testing.T) {
+			var output bytes.Buffer
+			format := filepath.Ext(name)[1:]
+			if err := Write(&output, g, format); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", name)
+			if *update {
+				if err := os.WriteFile(golden, output.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(output.Bytes(), want) {
+				t.Errorf("%s output differs from %s (rerun with -update to accept):\n%s", format, golden, output.String())
+			}
+		})
+	}
+
+	if err := Write(&bytes.Buffer{}, g, "svg"); err == nil {
+		t.Error("want an error for an unknown format")
+	}
+}
+
+func TestEgo(t *testing.T) {
+	g := FromProcessed(sampleUnits())
+
+	tests := []struct {
+		name   string
+		centre string
+		hops   int
+		want   []string
+	}{
+		{"centre only", "FIT2004", 0, []string{"FIT2004"}},
+		{"one hop either direction", "FIT2004", 1, []string{"FIT1008", "FIT2004", "FIT2014", "MAT1830"}},
+		{"across a prohibition", "FIT1053", 2, []string{"ENG1005", "FIT1045", "FIT1053"}},
+		{"unit outside the processed units", "MAT1830", 1, []string{"FIT2004", "MAT1830"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ego, err := g.Ego(test.centre, test.hops)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ego.SortedCodes(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	if _, err := g.Ego("FIT9999", 2); err == nil {
+		t.Error("want an error for a centre that is not in the graph")
+	}
+}
+
+func TestFaculty(t *testing.T) {
+	units := sampleUnits()
+	faculty := FromProcessed(units).Faculty("engineering", units)
+
+	if got, want := faculty.SortedCodes(), []string{"ENG1005", "FIT1045"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if faculty.Nodes["ENG1005"].External || !faculty.Nodes["FIT1045"].External {
+		t.Errorf("only units outside the faculty should be external: %+v, %+v", faculty.Nodes["ENG1005"], faculty.Nodes["FIT1045"])
+	}
+	if len(faculty.Edges) != 1 || faculty.Edges[0] != (Edge{From: "ENG1005", To: "FIT1045", Kind: Prerequisite}) {
+		t.Errorf("edges %v, want ENG1005 -> FIT1045", faculty.Edges)
+	}
+}
@@ -1,149 +1,287 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"handbook-scraper/format"
-	"handbook-scraper/process"
+	"handbook-scraper/config"
 	"handbook-scraper/scrape"
+	"handbook-scraper/storage"
+	"io"
 	"os"
+	"strings"
 )
 
-func main() {
-	// Use functions and logic from the scrape and requisites packages
-
-	// unify into scrape [aos, courses, units, requisites] format [units courses]
-	actionFlag := flag.String("choice", "scrape", "scrape, format, process")
-	contentFlag := flag.String("content", "courses", "aos, courses, units, requisites")
-	flag.Parse()
-
-	if _, err := os.Stat("data"); os.IsNotExist(err) {
-		os.Mkdir("data", os.ModeDir)
-	}
-	contentSplits := scrape.InitialiseContentSplits()
-	fmt.Print("Obtained content index\n")
-
-	switch *actionFlag {
-	case "scrape":
-		switch *contentFlag {
-
-		// Run this only after running the unit formatter
-		case "requisites":
-			fmt.Print("Doing requisites\n")
-
-			// Load the detected year from the format step
-			var year int = 2024 // Default fallback
-			yearFile, err := os.Open("data/detected_year.json")
-			if err == nil {
-				var yearData map[string]string
-				yearDecoder := json.NewDecoder(yearFile)
-				if err := yearDecoder.Decode(&yearData); err == nil {
-					if yearStr, ok := yearData["implementation_year"]; ok {
-						// Convert string year to int
-						fmt.Sscanf(yearStr, "%d", &year)
-						fmt.Printf("Using detected year: %d\n", year)
-					}
-				}
-				yearFile.Close()
-			} else {
-				fmt.Printf("Warning: Could not load detected year, using default: %d\n", year)
-			}
+const programName = "handbook-scraper"
 
-			var unitItems [][]string
+// Exit codes the nightly wrapper can tell apart
+const (
+	exitFailure    = 1
+	exitUsage      = 2
+	exitIncomplete = 3
+)
 
-			for _, item := range contentSplits["units"] {
-				unitItems = append(unitItems, []string{item})
-			}
+// usageError is a problem with the command line rather than with the pipeline.
+type usageError struct {
+	message string
+}
 
-			scrape.RequisiteScrape(unitItems, "prerequisites", year)
+func (err *usageError) Error() string {
+	return err.message
+}
 
-			file, err := os.Open("data/prohibition_candidates.json")
-			if err != nil {
-				fmt.Println("Error opening file:", err)
-				return
-			}
-			defer file.Close()
+func usagef(format string, args ...interface{}) error {
+	return &usageError{message: fmt.Sprintf(format, args...)}
+}
 
-			var prohibitionCandidates [][]string
+// command is one subcommand of the CLI.
+type command struct {
+	name    string
+	summary string
+	// choices are the accepted values of the command's one positional argument, nil if it takes none
+	choices []string
+	// setup binds the command's own flags and returns what to run once they are parsed
+	setup func(fs *flag.FlagSet) func(settings *config.Config, store storage.Store, arg string) error
+}
 
-			decoder := json.NewDecoder(file)
-			if err := decoder.Decode(&prohibitionCandidates); err != nil {
-				fmt.Println("Error decoding JSON:", err)
-				return
-			}
-			scrape.RequisiteScrape(prohibitionCandidates, "prohibitions", year)
+var commands []*command
+
+func init() {
+	contents := []string{"units", "courses", "aos"}
+	commands = []*command{
+		{name: "scrape", choices: contents, setup: setupScrape,
+			summary: "Scrape the handbook for one kind of content into raw_<content>.json"},
+		{name: "format", choices: contents, setup: setupFormat,
+			summary: "Format raw_<content>.json into formatted_<content>.json (offline)"},
+		{name: "requisites", setup: setupRequisites,
+			summary: "Ask MonPlan for every unit's requisites and prohibitions (after format units)"},
+		{name: "process", setup: setupProcess,
+			summary: "Merge formatted units with the MonPlan requisites into processed_units.json (offline)"},
+		{name: "run", setup: setupRun,
+			summary: "Run every stage that is out of date, resuming from the last failure"},
+		{name: "progress", setup: setupProgress,
+			summary: "Check completed units against a course's curriculum structure"},
+		{name: "unlocks", setup: setupUnlocks,
+			summary: "List the units that passing some units unlocks"},
+		{name: "eligible", setup: setupEligible,
+			summary: "List the units a student can enrol in, or explain one unit"},
+		{name: "plan", setup: setupPlan,
+			summary: "Lay out desired units over semesters"},
+		{name: "validate", setup: setupValidate,
+			summary: "Check a whole study plan file, optionally against MonPlan"},
+		{name: "graph", setup: setupGraph,
+			summary: "Export the requisite graph as DOT, GraphML or Mermaid"},
+		{name: "config", choices: []string{"print"}, setup: setupConfig,
+			summary: "Print the config merged from defaults, file, environment and flags"},
+	}
+}
 
-		default:
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
+	}
+}
 
-			scrape.HandbookScrape(*contentFlag, true) // Make separate function to save instead of doing it at once
+// exitCode maps a failure to the process exit status.
+func exitCode(err error) int {
+	var usage *usageError
+	switch {
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.Is(err, scrape.ErrIncomplete):
+		return exitIncomplete
+	default:
+		return exitFailure
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
 		}
+	}
+	return nil
+}
 
-	// Single responsibility into file -> saves to file in there
-	case "format":
-		fmt.Print("Formatting " + *contentFlag + "\n")
-		file, err := os.Open("data/raw_" + *contentFlag + ".json")
-		if err != nil {
-			fmt.Println("Could not find " + *contentFlag + ".json")
-			return
+func run(args []string) error {
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return usagef("no command given")
+	}
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		if len(args) < 2 {
+			printUsage(os.Stdout)
+			return nil
 		}
-		defer file.Close()
-		var raw_data []map[string]interface{}
-		var formatted_data map[string]interface{}
-		var detectedYear string
-		decoder := json.NewDecoder(file)
-		if err := decoder.Decode(&raw_data); err != nil {
-			fmt.Println("Error decoding JSON:", err)
-			return
+		cmd := findCommand(args[1])
+		if cmd == nil {
+			return usagef("unknown command %q", args[1])
 		}
+		fs, _ := newFlagSet(cmd)
+		cmd.setup(fs)
+		fs.SetOutput(os.Stdout)
+		fs.Usage()
+		return nil
+	}
 
-		switch *contentFlag {
-		case "units":
-			formatted_data, detectedYear = format.FormatUnits(raw_data)
-			// Save the detected year to a file for later use
-			yearData := map[string]string{"implementation_year": detectedYear}
-			yearJSON, _ := json.Marshal(yearData)
-			if err := os.WriteFile("data/detected_year.json", yearJSON, 0644); err != nil {
-				fmt.Println("Failed to write detected year:", err)
-			} else {
-				fmt.Printf("Saved detected year: %s\n", detectedYear)
-			}
-		case "aos":
-			formatted_data = format.FormatAOSs(raw_data)
-		case "courses":
-			formatted_data = format.FormatCourses(raw_data)
-		default:
-			fmt.Println("How did you even get here??")
-			return
-		}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		printUsage(os.Stderr)
+		return usagef("unknown command %q", args[0])
+	}
 
-		data, err := json.Marshal(formatted_data)
+	fs, loadSettings := newFlagSet(cmd)
+	action := cmd.setup(fs)
+	positional, err := parseArgs(fs, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return usagef("%s: %v", cmd.name, err)
+	}
+	arg, err := checkPositional(cmd, positional)
+	if err != nil {
+		fs.Usage()
+		return err
+	}
 
-		if err != nil {
-			fmt.Println("Error marshalling JSON:", err)
+	settings, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	// config only prints the settings, so it never creates the data directory
+	var store storage.Store
+	if cmd.name != "config" {
+		if store, err = storage.Open(settings.Storage, settings.DataDir); err != nil {
+			return err
 		}
+		defer store.Close()
+	}
+	return action(settings, store, arg)
+}
 
-		if err := os.WriteFile("data/formatted_"+*contentFlag+".json", data, 0644); err != nil {
-			fmt.Println("Failed to write to file:", err)
-		}
-		fmt.Println("Succesfully formatted " + *contentFlag + "\n")
-	case "process":
-		fmt.Print("Processing units")
-		processed := process.ProcessHandbook()
+// newFlagSet creates a command's flag set with the config flags every command shares.
+// The returned function merges the config once the flags are parsed.
+func newFlagSet(cmd *command) (*flag.FlagSet, func() (*config.Config, error)) {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	configFlag := fs.String("config", "", "JSON config file (default $"+config.EnvFile+" or "+config.DefaultFile+" if present)")
+	settingFlags := map[string]string{"config": ""}
+	// Only flags given on the command line are applied, so the defaults shown in -h never
+	// override the config file or the environment
+	defaults := config.Default()
+	for _, setting := range config.Settings {
+		value, _ := defaults.Get(setting.Key)
+		fs.String(config.FlagName(setting.Key), value, setting.Usage+" (env "+config.EnvName(setting.Key)+")")
+		settingFlags[config.FlagName(setting.Key)] = setting.Key
+	}
+	shared := func(name string) bool {
+		_, ok := settingFlags[name]
+		return ok
+	}
 
-		data, err := json.Marshal(processed)
+	fs.Usage = func() {
+		w := fs.Output()
+		usage := programName + " " + cmd.name
+		if cmd.choices != nil {
+			usage += " " + strings.Join(cmd.choices, "|")
+		}
+		fmt.Fprintf(w, "Usage: %s [flags]\n\n%s.\n", usage, cmd.summary)
+		if own := flagSubset(fs, func(name string) bool { return !shared(name) }); own != nil {
+			fmt.Fprintln(w, "\nFlags:")
+			own.PrintDefaults()
+		}
+		fmt.Fprintln(w, "\nConfig flags:")
+		flagSubset(fs, shared).PrintDefaults()
+	}
 
+	loadSettings := func() (*config.Config, error) {
+		settings, err := config.Load(*configFlag)
 		if err != nil {
-			fmt.Println("Error marshalling JSON:", err)
+			return nil, usagef("%v", err)
+		}
+		var flagErr error
+		fs.Visit(func(f *flag.Flag) {
+			if key := settingFlags[f.Name]; key != "" && flagErr == nil {
+				flagErr = settings.Set(key, f.Value.String())
+			}
+		})
+		if flagErr != nil {
+			return nil, usagef("%v", flagErr)
+		}
+		if err := settings.Validate(); err != nil {
+			return nil, usagef("invalid config: %v", err)
 		}
+		return settings, nil
+	}
+	return fs, loadSettings
+}
 
-		if err := os.WriteFile("data/processed_units.json", data, 0644); err != nil {
-			fmt.Println("Failed to write to file:", err)
+// flagSubset copies the flags of fs that keep selects so they can be printed as a group.
+// Returns nil when none are selected.
+func flagSubset(fs *flag.FlagSet, keep func(name string) bool) *flag.FlagSet {
+	subset := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	subset.SetOutput(fs.Output())
+	count := 0
+	fs.VisitAll(func(f *flag.Flag) {
+		if keep(f.Name) {
+			subset.Var(f.Value, f.Name, f.Usage)
+			subset.Lookup(f.Name).DefValue = f.DefValue
+			count++
 		}
-		fmt.Println("Succesfully processed " + *contentFlag)
+	})
+	if count == 0 {
+		return nil
+	}
+	return subset
+}
 
-	default:
-		fmt.Println("Not Recognised")
+// parseArgs parses flags on either side of the positional arguments, so
+// "scrape units --workers 4" and "scrape --workers 4 units" both work.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := make([]string, 0)
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
 	}
+}
 
+// checkPositional validates the command's positional argument against its choices.
+func checkPositional(cmd *command, positional []string) (string, error) {
+	if cmd.choices == nil {
+		if len(positional) > 0 {
+			return "", usagef("%s takes no arguments, got %s", cmd.name, strings.Join(positional, " "))
+		}
+		return "", nil
+	}
+	if len(positional) != 1 {
+		return "", usagef("%s needs one of %s", cmd.name, strings.Join(cmd.choices, ", "))
+	}
+	for _, choice := range cmd.choices {
+		if positional[0] == choice {
+			return choice, nil
+		}
+	}
+	return "", usagef("unknown %s argument %q: want one of %s", cmd.name, positional[0], strings.Join(cmd.choices, ", "))
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [arguments] [flags]\n\nCommands:\n", programName)
+	for _, cmd := range commands {
+		name := cmd.name
+		if cmd.choices != nil {
+			name += " " + strings.Join(cmd.choices, "|")
+		}
+		fmt.Fprintf(w, "  %-26s %s\n", name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nRun '%s help <command>' for a command's flags.\n", programName)
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Flags beat the environment, which beats the config file, and the defaults shown in -h
+// never override either.
+func TestSettingsPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"workers": 3, "retries": 2}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HANDBOOK_WORKERS", "5")
+
+	tests := []struct {
+		name    string
+		args    []string
+		workers int
+		retries int
+	}{
+		{"file, env and flag", []string{"-config", path, "-workers", "7"}, 7, 2},
+		{"file and env", []string{"-config", path}, 5, 2},
+		{"flag over file", []string{"-config", path, "-retries", "4"}, 5, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs, loadSettings := newFlagSet(&command{name: "config", summary: "Show the merged config"})
+			if err := fs.Parse(test.args); err != nil {
+				t.Fatal(err)
+			}
+			settings, err := loadSettings()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if settings.Workers != test.workers || settings.Retries != test.retries {
+				t.Errorf("workers %d, retries %d, want %d, %d", settings.Workers, settings.Retries, test.workers, test.retries)
+			}
+		})
+	}
+}
+
+func TestUsageShowsDefaults(t *testing.T) {
+	fs, _ := newFlagSet(&command{name: "config", summary: "Show the merged config"})
+	var out bytes.Buffer
+	fs.SetOutput(&out)
+	fs.Usage()
+	if !strings.Contains(out.String(), `-workers string`) || !strings.Contains(out.String(), `(default "10")`) {
+		t.Errorf("usage does not show the workers default:\n%s", out.String())
+	}
+}
@@ -0,0 +1,327 @@
+// Runs the pipeline as a DAG of stages, each declaring the artefacts it reads and writes.
+// A stage depends on the stages producing its inputs. Like make, a stage is skipped when its
+// outputs are all newer than its inputs; independent stages run at the same time unless one is
+// ordered after the other; and stages that failed last time are recorded in the store so the
+// next run resumes from them.
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"handbook-scraper/storage"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Stage struct {
+	Name    string
+	Inputs  []storage.Key
+	Outputs []storage.Key
+	// After names stages this one only waits for, without reading their outputs.
+	// They do not make it out of date.
+	After []string
+	// Run does the stage's work. resume is set when the stage failed in the previous run.
+	Run func(resume bool) error
+}
+
+type Options struct {
+	// Force runs every stage, whatever its outputs look like
+	Force bool
+	// Store holds the stage artefacts, and the stages that failed for the next run to resume from
+	Store storage.Store
+	// Partial reports failures that still leave usable outputs, such as an incomplete
+	// scrape. Dependent stages run on them, but the stage is retried next time.
+	Partial func(err error) bool
+}
+
+type state struct {
+	Failed []string `json:"failed"`
+}
+
+// StageError is the failure of one stage.
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (err *StageError) Error() string {
+	return fmt.Sprintf("stage %s: %v", err.Stage, err.Err)
+}
+
+func (err *StageError) Unwrap() error {
+	return err.Err
+}
+
+type status int
+
+const (
+	pending status = iota
+	running
+	skipped
+	succeeded
+	partial
+	failed
+)
+
+// dependencies maps each stage to the stages producing its inputs, and to every stage it
+// waits for: those and the ones it is ordered after.
+func dependencies(stages []Stage) (map[string][]string, map[string][]string, error) {
+	producers := make(map[storage.Key]string)
+	for _, stage := range stages {
+		for _, output := range stage.Outputs {
+			if other, ok := producers[output]; ok {
+				return nil, nil, fmt.Errorf("stages %s and %s both write %s", other, stage.Name, output)
+			}
+			producers[output] = stage.Name
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, stage := range stages {
+		names[stage.Name] = true
+	}
+
+	deps := make(map[string][]string)
+	waits := make(map[string][]string)
+	for _, stage := range stages {
+		seen := make(map[string]bool)
+		for _, input := range stage.Inputs {
+			producer, ok := producers[input]
+			if ok && producer != stage.Name && !seen[producer] {
+				seen[producer] = true
+				deps[stage.Name] = append(deps[stage.Name], producer)
+			}
+		}
+		waits[stage.Name] = append(waits[stage.Name], deps[stage.Name]...)
+		for _, name := range stage.After {
+			if !names[name] {
+				return nil, nil, fmt.Errorf("stage %s is ordered after unknown stage %s", stage.Name, name)
+			}
+			if !seen[name] {
+				seen[name] = true
+				waits[stage.Name] = append(waits[stage.Name], name)
+			}
+		}
+	}
+
+	// Reject cycles, which would never become ready
+	visiting := make(map[string]int)
+	var visit func(name string, trail []string) error
+	visit = func(name string, trail []string) error {
+		switch visiting[name] {
+		case 1:
+			return fmt.Errorf("stages form a cycle: %s", strings.Join(append(trail, name), " -> "))
+		case 2:
+			return nil
+		}
+		visiting[name] = 1
+		for _, dep := range waits[name] {
+			if err := visit(dep, append(trail, name)); err != nil {
+				return err
+			}
+		}
+		visiting[name] = 2
+		return nil
+	}
+	for _, stage := range stages {
+		if err := visit(stage.Name, nil); err != nil {
+			return nil, nil, err
+		}
+	}
+	return deps, waits, nil
+}
+
+// upToDate reports whether every output exists and is no older than the newest input.
+func upToDate(store storage.Store, stage Stage) bool {
+	var newestInput time.Time
+	for _, input := range stage.Inputs {
+		modified, err := store.Modified(input)
+		if err != nil {
+			return false
+		}
+		if modified.After(newestInput) {
+			newestInput = modified
+		}
+	}
+	for _, output := range stage.Outputs {
+		modified, err := store.Modified(output)
+		if err != nil || modified.Before(newestInput) {
+			return false
+		}
+	}
+	return len(stage.Outputs) > 0
+}
+
+func loadState(store storage.Store) (map[string]bool, error) {
+	failedBefore := make(map[string]bool)
+	var saved state
+	err := store.Get(storage.RunState, &saved)
+	if errors.Is(err, storage.ErrNotFound) {
+		return failedBefore, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading run state: %w", err)
+	}
+	for _, name := range saved.Failed {
+		failedBefore[name] = true
+	}
+	return failedBefore, nil
+}
+
+func saveState(store storage.Store, failedStages []string) error {
+	if len(failedStages) == 0 {
+		return store.Delete(storage.RunState)
+	}
+	sort.Strings(failedStages)
+	return store.Put(storage.RunState, state{Failed: failedStages})
+}
+
+// Run executes the stages in dependency order.
+// After a stage fails no new stages are started; the ones already running are waited for.
+// Returns the first failure, or the first partial failure when everything else succeeded.
+func Run(stages []Stage, options Options) error {
+	deps, waits, err := dependencies(stages)
+	if err != nil {
+		return err
+	}
+	failedBefore, err := loadState(options.Store)
+	if err != nil {
+		return err
+	}
+
+	statuses := make(map[string]status)
+	ran := make(map[string]bool)
+	stageErrors := make(map[string]error)
+	var order []string
+	var mutex sync.Mutex
+	done := make(chan string)
+	inFlight := 0
+	stopped := false
+
+	// ready reports whether every stage waited for finished with usable outputs
+	ready := func(stage Stage) bool {
+		for _, dep := range waits[stage.Name] {
+			switch statuses[dep] {
+			case skipped, succeeded, partial:
+			default:
+				return false
+			}
+		}
+		return true
+	}
+
+	for {
+		mutex.Lock()
+		for _, stage := range stages {
+			if stopped || statuses[stage.Name] != pending || !ready(stage) {
+				continue
+			}
+
+			depRan := false
+			for _, dep := range deps[stage.Name] {
+				depRan = depRan || ran[dep]
+			}
+			resume := failedBefore[stage.Name]
+			if !options.Force && !resume && !depRan && upToDate(options.Store, stage) {
+				statuses[stage.Name] = skipped
+				fmt.Printf("--- %s is up to date\n", stage.Name)
+				continue
+			}
+
+			statuses[stage.Name] = running
+			ran[stage.Name] = true
+			inFlight++
+			if resume {
+				fmt.Printf("==> %s (resuming)\n", stage.Name)
+			} else {
+				fmt.Printf("==> %s\n", stage.Name)
+			}
+			go func(stage Stage, resume bool) {
+				err := stage.Run(resume)
+				mutex.Lock()
+				stageErrors[stage.Name] = err
+				mutex.Unlock()
+				done <- stage.Name
+			}(stage, resume)
+		}
+
+		// Skipping can make further stages ready without anything running
+		progressed := false
+		for _, stage := range stages {
+			if statuses[stage.Name] == pending && !stopped && ready(stage) {
+				progressed = true
+			}
+		}
+		mutex.Unlock()
+		if progressed {
+			continue
+		}
+		if inFlight == 0 {
+			break
+		}
+
+		name := <-done
+		inFlight--
+		mutex.Lock()
+		err := stageErrors[name]
+		switch {
+		case err == nil:
+			statuses[name] = succeeded
+			fmt.Printf("<== %s done\n", name)
+		case options.Partial != nil && options.Partial(err):
+			statuses[name] = partial
+			order = append(order, name)
+			fmt.Printf("<== %s incomplete: %v\n", name, err)
+		default:
+			statuses[name] = failed
+			order = append(order, name)
+			stopped = true
+			fmt.Printf("<== %s failed: %v\n", name, err)
+		}
+		mutex.Unlock()
+	}
+
+	// Stages never reached keep their earlier failure, so the next run still resumes them
+	var failedStages []string
+	for _, stage := range stages {
+		switch statuses[stage.Name] {
+		case failed, partial:
+			failedStages = append(failedStages, stage.Name)
+		case pending:
+			if failedBefore[stage.Name] {
+				failedStages = append(failedStages, stage.Name)
+			}
+		}
+	}
+	if err := saveState(options.Store, failedStages); err != nil {
+		return err
+	}
+
+	var firstPartial error
+	for _, name := range order {
+		stageErr := &StageError{Stage: name, Err: stageErrors[name]}
+		if statuses[name] == failed {
+			return stageErr
+		}
+		if firstPartial == nil {
+			firstPartial = stageErr
+		}
+	}
+	if firstPartial != nil {
+		return firstPartial
+	}
+
+	var notRun []string
+	for _, stage := range stages {
+		if statuses[stage.Name] == pending {
+			notRun = append(notRun, stage.Name)
+		}
+	}
+	if len(notRun) > 0 {
+		return errors.New("stages never became ready: " + strings.Join(notRun, ", "))
+	}
+	return nil
+}
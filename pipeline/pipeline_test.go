@@ -0,0 +1,178 @@
+package pipeline
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"handbook-scraper/storage"
+)
+
+var errIncomplete = errors.New("incomplete")
+
+// recorder builds stages that write their outputs and log each run.
+type recorder struct {
+	t     *testing.T
+	store *storage.FileStore
+	mutex sync.Mutex
+	runs  []string
+	fail  map[string]error
+}
+
+func newRecorder(t *testing.T) *recorder {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &recorder{t: t, store: store, fail: make(map[string]error)}
+}
+
+func (r *recorder) stage(name string, inputs []storage.Key, after ...string) Stage {
+	output := storage.Key(name)
+	return Stage{
+		Name:    name,
+		Inputs:  inputs,
+		Outputs: []storage.Key{output},
+		After:   after,
+		Run: func(resume bool) error {
+			r.mutex.Lock()
+			run := name
+			if resume {
+				run += " (resuming)"
+			}
+			r.runs = append(r.runs, run)
+			err := r.fail[name]
+			r.mutex.Unlock()
+			if err != nil && !errors.Is(err, errIncomplete) {
+				return err
+			}
+			if putErr := r.store.Put(output, name); putErr != nil {
+				return putErr
+			}
+			return err
+		},
+	}
+}
+
+func (r *recorder) run(stages []Stage) ([]string, error) {
+	r.runs = nil
+	err := Run(stages, Options{
+		Store:   r.store,
+		Partial: func(err error) bool { return errors.Is(err, errIncomplete) },
+	})
+	return r.runs, err
+}
+
+// age backdates an artefact so anything written afterwards is newer.
+func (r *recorder) age(key storage.Key) {
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(r.store.Path(key), old, old); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// chain is a -> b -> c through their outputs.
+func (r *recorder) chain() []Stage {
+	return []Stage{
+		r.stage("a", nil),
+		r.stage("b", []storage.Key{"a"}),
+		r.stage("c", []storage.Key{"b"}),
+	}
+}
+
+func TestRunSkipsUpToDateStages(t *testing.T) {
+	r := newRecorder(t)
+	stages := r.chain()
+
+	if runs, err := r.run(stages); err != nil || !reflect.DeepEqual(runs, []string{"a", "b", "c"}) {
+		t.Fatalf("first run: runs %v, err %v", runs, err)
+	}
+	if runs, err := r.run(stages); err != nil || len(runs) != 0 {
+		t.Fatalf("second run: runs %v, err %v, want nothing run", runs, err)
+	}
+
+	// A newer input reruns its stage and everything after it
+	r.age("b")
+	r.age("c")
+	if runs, err := r.run(stages); err != nil || !reflect.DeepEqual(runs, []string{"b", "c"}) {
+		t.Fatalf("after a changed: runs %v, err %v", runs, err)
+	}
+}
+
+func TestRunResumesFailedStage(t *testing.T) {
+	r := newRecorder(t)
+	stages := r.chain()
+	r.fail["b"] = errors.New("rate limited")
+
+	runs, err := r.run(stages)
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "b" {
+		t.Fatalf("err = %v, want a failure of b", err)
+	}
+	if !reflect.DeepEqual(runs, []string{"a", "b"}) {
+		t.Fatalf("runs %v, want c left out after b failed", runs)
+	}
+
+	delete(r.fail, "b")
+	if runs, err := r.run(stages); err != nil || !reflect.DeepEqual(runs, []string{"b (resuming)", "c"}) {
+		t.Fatalf("resumed run: runs %v, err %v", runs, err)
+	}
+	if runs, err := r.run(stages); err != nil || len(runs) != 0 {
+		t.Fatalf("after resuming: runs %v, err %v, want nothing run", runs, err)
+	}
+}
+
+func TestRunPartialStage(t *testing.T) {
+	r := newRecorder(t)
+	stages := r.chain()
+	r.fail["b"] = errIncomplete
+
+	runs, err := r.run(stages)
+	if !errors.Is(err, errIncomplete) {
+		t.Fatalf("err = %v, want the partial failure", err)
+	}
+	if !reflect.DeepEqual(runs, []string{"a", "b", "c"}) {
+		t.Fatalf("runs %v, want c run on b's partial output", runs)
+	}
+
+	delete(r.fail, "b")
+	if runs, err := r.run(stages); err != nil || !reflect.DeepEqual(runs, []string{"b (resuming)", "c"}) {
+		t.Fatalf("resumed run: runs %v, err %v", runs, err)
+	}
+}
+
+func TestRunAfterOrdersWithoutDepending(t *testing.T) {
+	r := newRecorder(t)
+	stages := []Stage{
+		r.stage("units", nil, "courses"),
+		r.stage("courses", []storage.Key{"source"}),
+	}
+	if err := r.store.Put("source", "source"); err != nil {
+		t.Fatal(err)
+	}
+
+	if runs, err := r.run(stages); err != nil || !reflect.DeepEqual(runs, []string{"courses", "units"}) {
+		t.Fatalf("runs %v, err %v, want units after courses", runs, err)
+	}
+
+	// Rerunning courses does not make units out of date
+	r.age("courses")
+	r.age("units")
+	if runs, err := r.run(stages); err != nil || !reflect.DeepEqual(runs, []string{"courses"}) {
+		t.Fatalf("runs %v, err %v, want only courses", runs, err)
+	}
+}
+
+func TestRunRejectsCycles(t *testing.T) {
+	r := newRecorder(t)
+	stages := []Stage{
+		r.stage("a", []storage.Key{"b"}),
+		r.stage("b", nil, "a"),
+	}
+	if _, err := r.run(stages); err == nil {
+		t.Fatal("want an error for stages that wait on each other")
+	}
+}
@@ -0,0 +1,198 @@
+package process
+
+import "sort"
+
+// Analysis of the requisite graph: cycles, prerequisite chain depth and earliest year of study.
+// Cycles made only of corequisite edges are mutual corequisites and are expected;
+// any cycle through a prerequisite edge can never be satisfied.
+
+const (
+	CycleMutualCorequisite = "mutual_corequisite"
+	CyclePrerequisite      = "prerequisite_cycle"
+
+	// Semesters in a standard study year, and credit points a full time student takes per year
+	semestersPerYear    = 2
+	creditPointsPerYear = 48
+)
+
+type RequisiteCycle struct {
+	Kind  string   `json:"kind"`
+	Units []string `json:"units"`
+}
+
+type UnitAnalysis struct {
+	Depth        int    `json:"depth"`
+	EarliestYear int    `json:"earliest_year"`
+	Cycle        string `json:"cycle,omitempty"`
+}
+
+type GraphAnalysis struct {
+	Cycles   []RequisiteCycle         `json:"cycles"`
+	MaxDepth int                      `json:"max_depth"`
+	Units    map[string]*UnitAnalysis `json:"units"`
+}
+
+type requisiteEdge struct {
+	to           string
+	prerequisite bool
+}
+
+// strongComponents runs Tarjan's algorithm over the requisite edges.
+func strongComponents(nodes []string, edges map[string][]requisiteEdge) [][]string {
+	index := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+	components := make([][]string, 0)
+	counter := 0
+
+	var visit func(node string)
+	visit = func(node string) {
+		index[node] = counter
+		lowlink[node] = counter
+		counter++
+		stack = append(stack, node)
+		onStack[node] = true
+
+		for _, edge := range edges[node] {
+			if _, seen := index[edge.to]; !seen {
+				visit(edge.to)
+				lowlink[node] = min(lowlink[node], lowlink[edge.to])
+			} else if onStack[edge.to] {
+				lowlink[node] = min(lowlink[node], index[edge.to])
+			}
+		}
+
+		if lowlink[node] == index[node] {
+			component := make([]string, 0)
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == node {
+					break
+				}
+			}
+			components = append(components, component)
+		}
+	}
+
+	for _, node := range nodes {
+		if _, seen := index[node]; !seen {
+			visit(node)
+		}
+	}
+	return components
+}
+
+// AnalyseRequisites finds cycles and computes the depth and earliest year of every unit.
+// Depth is the longest chain of prerequisites below a unit; units in a prerequisite
+// cycle are treated as one step so the remaining units still get a depth.
+func AnalyseRequisites(requisites map[string]*RefinedRequisite) *GraphAnalysis {
+	edges := make(map[string][]requisiteEdge)
+	nodeSet := make(map[string]bool)
+
+	for unit, requisite := range requisites {
+		nodeSet[unit] = true
+		if requisite == nil {
+			continue
+		}
+		for _, prerequisite := range requisite.PrerequisiteTree.Units() {
+			nodeSet[prerequisite] = true
+			edges[prerequisite] = append(edges[prerequisite], requisiteEdge{to: unit, prerequisite: true})
+		}
+		for _, corequisite := range requisite.CorequisiteTree.Units() {
+			nodeSet[corequisite] = true
+			edges[corequisite] = append(edges[corequisite], requisiteEdge{to: unit, prerequisite: false})
+		}
+	}
+
+	nodes := make([]string, 0, len(nodeSet))
+	for node := range nodeSet {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	analysis := &GraphAnalysis{
+		Cycles: make([]RequisiteCycle, 0),
+		Units:  make(map[string]*UnitAnalysis),
+	}
+	for _, node := range nodes {
+		analysis.Units[node] = &UnitAnalysis{}
+	}
+
+	// Classify each strongly connected component and remember which one every unit is in
+	components := strongComponents(nodes, edges)
+	componentOf := make(map[string]int)
+	for idx, component := range components {
+		for _, unit := range component {
+			componentOf[unit] = idx
+		}
+	}
+	for idx, component := range components {
+		kind := ""
+		for _, unit := range component {
+			for _, edge := range edges[unit] {
+				if componentOf[edge.to] != idx {
+					continue
+				}
+				if edge.prerequisite {
+					kind = CyclePrerequisite
+				} else if kind == "" {
+					kind = CycleMutualCorequisite
+				}
+			}
+		}
+		if kind == "" {
+			continue
+		}
+		sort.Strings(component)
+		analysis.Cycles = append(analysis.Cycles, RequisiteCycle{Kind: kind, Units: component})
+		for _, unit := range component {
+			analysis.Units[unit].Cycle = kind
+		}
+	}
+	sort.Slice(analysis.Cycles, func(i, j int) bool {
+		if analysis.Cycles[i].Kind != analysis.Cycles[j].Kind {
+			return analysis.Cycles[i].Kind > analysis.Cycles[j].Kind
+		}
+		return analysis.Cycles[i].Units[0] < analysis.Cycles[j].Units[0]
+	})
+
+	// Tarjan emits components in reverse topological order, so walking them backwards
+	// visits every prerequisite before the units it unlocks
+	componentDepth := make([]int, len(components))
+	for idx := len(components) - 1; idx >= 0; idx-- {
+		for _, unit := range components[idx] {
+			for _, edge := range edges[unit] {
+				target := componentOf[edge.to]
+				if target != idx && edge.prerequisite {
+					componentDepth[target] = max(componentDepth[target], componentDepth[idx]+1)
+				}
+			}
+		}
+	}
+
+	for unit, unitAnalysis := range analysis.Units {
+		unitAnalysis.Depth = componentDepth[componentOf[unit]]
+		analysis.MaxDepth = max(analysis.MaxDepth, unitAnalysis.Depth)
+		unitAnalysis.EarliestYear = earliestYear(unitAnalysis.Depth, requisites[unit])
+	}
+
+	return analysis
+}
+
+// earliestYear assumes one prerequisite step per semester and a full time load of credit points.
+func earliestYear(depth int, requisite *RefinedRequisite) int {
+	year := depth/semestersPerYear + 1
+
+	if requisite != nil {
+		for _, constraint := range requisite.CreditPoints {
+			if constraint.Kind == CreditPointsPassed && constraint.Level == 0 && constraint.Discipline == "" {
+				year = max(year, constraint.Amount/creditPointsPerYear+1)
+			}
+		}
+	}
+	return year
+}
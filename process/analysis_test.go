@@ -0,0 +1,116 @@
+package process
+
+import (
+	"reflect"
+	"testing"
+)
+
+// requisites builds refined requisites from prerequisite and corequisite trees by unit.
+func requisites(prerequisites map[string]*RequisiteNode, corequisites map[string]*RequisiteNode) map[string]*RefinedRequisite {
+	refined := make(map[string]*RefinedRequisite)
+	entry := func(unit string) *RefinedRequisite {
+		if refined[unit] == nil {
+			refined[unit] = newRefinedRequisite()
+		}
+		return refined[unit]
+	}
+	for unit, tree := range prerequisites {
+		entry(unit).PrerequisiteTree = tree
+	}
+	for unit, tree := range corequisites {
+		entry(unit).CorequisiteTree = tree
+	}
+	return refined
+}
+
+func TestAnalyseRequisites(t *testing.T) {
+	type want struct {
+		depth        int
+		earliestYear int
+		cycle        string
+	}
+
+	tests := []struct {
+		name       string
+		requisites map[string]*RefinedRequisite
+		cycles     []RequisiteCycle
+		maxDepth   int
+		units      map[string]want
+	}{
+		{
+			name: "linear chain",
+			requisites: requisites(map[string]*RequisiteNode{
+				"FIT1008": UnitNode("FIT1045"),
+				"FIT2004": UnitNode("FIT1008"),
+				"FIT3155": UnitNode("FIT2004"),
+			}, nil),
+			cycles:   []RequisiteCycle{},
+			maxDepth: 3,
+			units: map[string]want{
+				"FIT1045": {0, 1, ""},
+				"FIT1008": {1, 1, ""},
+				"FIT2004": {2, 2, ""},
+				"FIT3155": {3, 2, ""},
+			},
+		},
+		{
+			name: "mutual corequisite",
+			requisites: requisites(nil, map[string]*RequisiteNode{
+				"ENG1011": UnitNode("ENG1012"),
+				"ENG1012": UnitNode("ENG1011"),
+			}),
+			cycles: []RequisiteCycle{{Kind: CycleMutualCorequisite, Units: []string{"ENG1011", "ENG1012"}}},
+			units: map[string]want{
+				"ENG1011": {0, 1, CycleMutualCorequisite},
+				"ENG1012": {0, 1, CycleMutualCorequisite},
+			},
+		},
+		{
+			name: "prerequisite cycle",
+			requisites: requisites(map[string]*RequisiteNode{
+				"TRM5003": UnitNode("TRM5010"),
+				"TRM5010": UnitNode("TRM5003"),
+				"TRM5020": UnitNode("TRM5010"),
+			}, nil),
+			cycles:   []RequisiteCycle{{Kind: CyclePrerequisite, Units: []string{"TRM5003", "TRM5010"}}},
+			maxDepth: 1,
+			units: map[string]want{
+				"TRM5003": {0, 1, CyclePrerequisite},
+				"TRM5010": {0, 1, CyclePrerequisite},
+				"TRM5020": {1, 1, ""},
+			},
+		},
+		{
+			name: "credit points push the earliest year back",
+			requisites: map[string]*RefinedRequisite{
+				"FIT3170": {CreditPoints: []CreditPointConstraint{{Kind: CreditPointsPassed, Amount: 96}}},
+			},
+			cycles: []RequisiteCycle{},
+			units: map[string]want{
+				"FIT3170": {0, 3, ""},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			analysis := AnalyseRequisites(test.requisites)
+			if !reflect.DeepEqual(analysis.Cycles, test.cycles) {
+				t.Errorf("cycles %+v, want %+v", analysis.Cycles, test.cycles)
+			}
+			if analysis.MaxDepth != test.maxDepth {
+				t.Errorf("max depth %d, want %d", analysis.MaxDepth, test.maxDepth)
+			}
+			for unit, expected := range test.units {
+				got := analysis.Units[unit]
+				if got == nil {
+					t.Errorf("%s missing from the analysis", unit)
+					continue
+				}
+				if (want{got.Depth, got.EarliestYear, got.Cycle}) != expected {
+					t.Errorf("%s: depth %d, year %d, cycle %q, want %+v", unit, got.Depth, got.EarliestYear, got.Cycle, expected)
+				}
+			}
+		})
+	}
+}
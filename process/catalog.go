@@ -0,0 +1,147 @@
+package process
+
+import (
+	"handbook-scraper/codes"
+	"handbook-scraper/format"
+)
+
+// Joins processed units, formatted courses and formatted areas of study into one catalog,
+// cross-referenced by code. References to codes missing from the catalog are listed
+// in its validation section rather than dropped.
+
+type DanglingReference struct {
+	From     string `json:"from"`
+	FromKind string `json:"from_kind"`
+	Code     string `json:"code"`
+	Kind     string `json:"kind"`
+}
+
+type CatalogValidation struct {
+	DanglingUnits   []DanglingReference `json:"dangling_units"`
+	DanglingAOS     []DanglingReference `json:"dangling_aos"`
+	DanglingCourses []DanglingReference `json:"dangling_courses"`
+}
+
+type Catalog struct {
+	Units      map[string]interface{} `json:"units"`
+	Courses    map[string]interface{} `json:"courses"`
+	AOS        map[string]interface{} `json:"aos"`
+	Validation CatalogValidation      `json:"validation"`
+}
+
+// structureLeaves collects the unit, AOS and course leaves of a formatted record's structure by kind.
+func structureLeaves(record map[string]interface{}) map[format.RequirementKind][]string {
+	leaves := make(map[format.RequirementKind][]string)
+	structure, err := structureFromRecord(record)
+	if err != nil {
+		return leaves
+	}
+
+	var walk func(node *format.RequirementNode)
+	walk = func(node *format.RequirementNode) {
+		if node == nil {
+			return
+		}
+		switch node.Kind {
+		case format.RequirementUnit, format.RequirementAOS, format.RequirementCourse:
+			if node.Code != "" {
+				leaves[node.Kind] = append(leaves[node.Kind], node.Code)
+			}
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(format.BuildRequirementTree("", structure))
+
+	for kind := range leaves {
+		leaves[kind] = codes.UniqueSorted(leaves[kind])
+	}
+	return leaves
+}
+
+// BuildCatalog cross-references the three collections. Courses gain the units and AOS their
+// structures name, AOS gain their units and the courses that offer them, and units keep
+// the used_in membership from processing.
+func BuildCatalog(units map[string]interface{}, courses map[string]interface{}, aos map[string]interface{}) *Catalog {
+	catalog := &Catalog{
+		Units:   units,
+		Courses: courses,
+		AOS:     aos,
+		Validation: CatalogValidation{
+			DanglingUnits:   make([]DanglingReference, 0),
+			DanglingAOS:     make([]DanglingReference, 0),
+			DanglingCourses: make([]DanglingReference, 0),
+		},
+	}
+
+	check := func(from string, fromKind string, referenced []string, kind format.RequirementKind) []string {
+		known := make([]string, 0, len(referenced))
+		for _, code := range referenced {
+			var exists bool
+			switch kind {
+			case format.RequirementUnit:
+				_, exists = units[code]
+			case format.RequirementAOS:
+				_, exists = aos[code]
+			case format.RequirementCourse:
+				_, exists = courses[code]
+			}
+			if exists {
+				known = append(known, code)
+				continue
+			}
+
+			reference := DanglingReference{From: from, FromKind: fromKind, Code: code, Kind: string(kind)}
+			switch kind {
+			case format.RequirementUnit:
+				catalog.Validation.DanglingUnits = append(catalog.Validation.DanglingUnits, reference)
+			case format.RequirementAOS:
+				catalog.Validation.DanglingAOS = append(catalog.Validation.DanglingAOS, reference)
+			case format.RequirementCourse:
+				catalog.Validation.DanglingCourses = append(catalog.Validation.DanglingCourses, reference)
+			}
+		}
+		return known
+	}
+
+	offeredBy := make(map[string][]string)
+
+	for _, code := range codes.SortedKeys(courses) {
+		record, ok := courses[code].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		leaves := structureLeaves(record)
+		areas := codes.UniqueSorted(append(leaves[format.RequirementAOS], stringList(record["aos_codes"])...))
+		components := codes.UniqueSorted(append(leaves[format.RequirementCourse], stringList(record["component_courses"])...))
+
+		record["units"] = nonNil(check(code, "course", leaves[format.RequirementUnit], format.RequirementUnit))
+		record["areas_of_study"] = nonNil(check(code, "course", areas, format.RequirementAOS))
+		check(code, "course", components, format.RequirementCourse)
+
+		for _, area := range record["areas_of_study"].([]string) {
+			offeredBy[area] = append(offeredBy[area], code)
+		}
+	}
+
+	for _, code := range codes.SortedKeys(aos) {
+		record, ok := aos[code].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		leaves := structureLeaves(record)
+		record["units"] = nonNil(check(code, "aos", leaves[format.RequirementUnit], format.RequirementUnit))
+		record["areas_of_study"] = nonNil(check(code, "aos", leaves[format.RequirementAOS], format.RequirementAOS))
+		record["used_in_courses"] = nonNil(codes.UniqueSorted(offeredBy[code]))
+	}
+
+	return catalog
+}
+
+func nonNil(items []string) []string {
+	if items == nil {
+		return make([]string, 0)
+	}
+	return items
+}
@@ -0,0 +1,113 @@
+package process
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Credit point requirements from MonPlan messages.
+// A message may carry several constraints, e.g. "48 credit points including 12 at level 2"
+// is 48 credit points overall and 12 of them at level 2.
+
+const (
+	CreditPointsPassed   = "passed"
+	CreditPointsEnrolled = "enrolled"
+)
+
+type CreditPointConstraint struct {
+	Kind         string `json:"kind"`
+	Amount       int    `json:"amount"`
+	Level        int    `json:"level,omitempty"`
+	LevelOrAbove bool   `json:"level_or_above,omitempty"`
+	Discipline   string `json:"discipline,omitempty"`
+	Source       string `json:"source"`
+}
+
+var (
+	// An amount followed by "credit points"/"cp", with an optional level or discipline qualifier
+	creditAmountPattern = regexp.MustCompile(`(?i)\b([0-9]{1,3})\s*(?:credit[ -]points?|cps?|points)\b`)
+	includingPattern    = regexp.MustCompile(`(?i)including\s+([0-9]{1,3})(?:\s*(?:credit[ -]points?|cps?|points))?`)
+	levelPattern        = regexp.MustCompile(`(?i)^[^0-9]{0,30}?\b(?:at|from)\s+level\s+([1-9])(\s+or\s+(?:above|higher)|\+)?`)
+	disciplinePattern   = regexp.MustCompile(`^[^0-9]{0,30}?\b(?:of|in|from)\s+([A-Z]{3,4})\b`)
+	bareNumberPattern   = regexp.MustCompile(`\b([0-9]{1,3})\b`)
+	anyLevelPattern     = regexp.MustCompile(`(?i)\b(?:at|from)\s+level\s+([1-9])(\s+or\s+(?:above|higher)|\+)?`)
+)
+
+// creditPointKind tells passed from enrolled requirements by the MonPlan title.
+func creditPointKind(title string) string {
+	if strings.Contains(normaliseTitle(title), "enrolled") {
+		return CreditPointsEnrolled
+	}
+	return CreditPointsPassed
+}
+
+// qualify reads a level or discipline qualifier from the text following an amount.
+func qualify(constraint *CreditPointConstraint, rest string) {
+	if match := levelPattern.FindStringSubmatch(rest); match != nil {
+		constraint.Level, _ = strconv.Atoi(match[1])
+		constraint.LevelOrAbove = match[2] != ""
+	}
+	if match := disciplinePattern.FindStringSubmatch(rest); match != nil && !strings.EqualFold(match[1], "level") {
+		constraint.Discipline = match[1]
+	}
+}
+
+// ParseCreditPointConstraints reads every credit point constraint out of a MonPlan message.
+// Numbers that are levels ("level 2") are never taken as amounts.
+func ParseCreditPointConstraints(title string, description string) []CreditPointConstraint {
+	kind := creditPointKind(title)
+	constraints := make([]CreditPointConstraint, 0)
+
+	includingLocs := includingPattern.FindAllStringSubmatchIndex(description, -1)
+	isIncluded := func(start int) bool {
+		for _, loc := range includingLocs {
+			if start >= loc[2] && start < loc[3] {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, loc := range creditAmountPattern.FindAllStringSubmatchIndex(description, -1) {
+		if isIncluded(loc[2]) {
+			continue
+		}
+		amount, _ := strconv.Atoi(description[loc[2]:loc[3]])
+		constraint := CreditPointConstraint{Kind: kind, Amount: amount, Source: description}
+		qualify(&constraint, description[loc[1]:])
+		constraints = append(constraints, constraint)
+	}
+
+	// Fall back to the first number that is not a level, e.g. "You need 24 more"
+	if len(constraints) == 0 {
+		for _, loc := range bareNumberPattern.FindAllStringSubmatchIndex(description, -1) {
+			preceding := strings.ToLower(description[:loc[0]])
+			if strings.HasSuffix(strings.TrimSpace(preceding), "level") || isIncluded(loc[2]) {
+				continue
+			}
+			amount, _ := strconv.Atoi(description[loc[2]:loc[3]])
+			constraint := CreditPointConstraint{Kind: kind, Amount: amount, Source: description}
+			qualify(&constraint, description[loc[1]:])
+			constraints = append(constraints, constraint)
+			break
+		}
+	}
+
+	// "...credit points at level 2: 36 required" puts the qualifier before the amount
+	if len(constraints) == 1 && len(includingLocs) == 0 && constraints[0].Level == 0 {
+		if match := anyLevelPattern.FindStringSubmatch(description); match != nil {
+			constraints[0].Level, _ = strconv.Atoi(match[1])
+			constraints[0].LevelOrAbove = match[2] != ""
+		}
+	}
+
+	for _, loc := range includingLocs {
+		amount, _ := strconv.Atoi(description[loc[2]:loc[3]])
+		constraint := CreditPointConstraint{Kind: kind, Amount: amount, Source: description}
+		qualify(&constraint, description[loc[1]:])
+		constraints = append(constraints, constraint)
+	}
+
+	return constraints
+}
@@ -0,0 +1,163 @@
+package process
+
+import (
+	"handbook-scraper/codes"
+	"sort"
+)
+
+// Decides which units a student can enrol in, and for the rest exactly which clause is unmet.
+// Prerequisites are checked against completed units only; corequisites may also be met by
+// current enrolments. Prohibitions fail if the prohibited unit is completed or enrolled, and
+// course exclusions fail if the student's course is one the unit keeps out.
+
+const (
+	ClausePrerequisite    = "prerequisite"
+	ClauseCorequisite     = "corequisite"
+	ClauseProhibition     = "prohibition"
+	ClauseCourseExclusion = "course_exclusion"
+)
+
+type EligibilityQuery struct {
+	Completed    []string `json:"completed"`
+	Enrolled     []string `json:"enrolled"`
+	CreditPoints int      `json:"credit_points,omitempty"`
+	Course       string   `json:"course,omitempty"`
+}
+
+type UnmetClause struct {
+	Kind   string         `json:"kind"`
+	Clause string         `json:"clause"`
+	Tree   *RequisiteNode `json:"tree,omitempty"`
+	Units  []string       `json:"units,omitempty"`
+}
+
+type UnitEligibility struct {
+	Unit               string        `json:"unit"`
+	Eligible           bool          `json:"eligible"`
+	RequiresPermission bool          `json:"requires_permission,omitempty"`
+	Unmet              []UnmetClause `json:"unmet,omitempty"`
+}
+
+type EligibilityReport struct {
+	Query      EligibilityQuery   `json:"query"`
+	Eligible   []string           `json:"eligible"`
+	Ineligible []*UnitEligibility `json:"ineligible"`
+}
+
+// EligibilityChecker holds the evaluation contexts for one student so many units can be checked cheaply.
+type EligibilityChecker struct {
+	units         map[string]*ProcessedUnit
+	prerequisites *EvalContext
+	corequisites  *EvalContext
+	taken         map[string]bool
+}
+
+func NewEligibilityChecker(units map[string]*ProcessedUnit, query EligibilityQuery) *EligibilityChecker {
+	unitCreditPoints := make(map[string]int)
+	for code, unit := range units {
+		unitCreditPoints[code] = unit.Points()
+	}
+
+	completed := make(map[string]bool)
+	enrolled := make(map[string]bool)
+	taken := make(map[string]bool)
+	for _, unit := range query.Completed {
+		completed[unit] = true
+		taken[unit] = true
+	}
+	for _, unit := range query.Enrolled {
+		enrolled[unit] = true
+		taken[unit] = true
+	}
+
+	return &EligibilityChecker{
+		units: units,
+		prerequisites: &EvalContext{
+			Completed:        completed,
+			Enrolled:         enrolled,
+			UnitCreditPoints: unitCreditPoints,
+			CreditPoints:     query.CreditPoints,
+			Course:           query.Course,
+		},
+		corequisites: &EvalContext{
+			Completed:        taken,
+			UnitCreditPoints: unitCreditPoints,
+			Course:           query.Course,
+		},
+		taken: taken,
+	}
+}
+
+// prohibitedUnits joins a unit's own prohibitions with the units that prohibit it,
+// since either direction stops the two being taken together.
+func prohibitedUnits(unit *ProcessedUnit) []string {
+	return codes.UniqueSorted(append(append([]string{}, unit.ProhibitedUnits()...), unit.ProhibitedBy...))
+}
+
+// Check evaluates a single unit. Units missing from the processed data are reported as ineligible.
+func (checker *EligibilityChecker) Check(code string) *UnitEligibility {
+	result := &UnitEligibility{Unit: code, Unmet: make([]UnmetClause, 0)}
+
+	unit, ok := checker.units[code]
+	if !ok {
+		result.Unmet = append(result.Unmet, UnmetClause{Kind: ClausePrerequisite, Clause: "UNKNOWN UNIT " + code})
+		return result
+	}
+
+	clashes := make([]string, 0)
+	for _, prohibited := range prohibitedUnits(unit) {
+		if checker.taken[prohibited] {
+			clashes = append(clashes, prohibited)
+		}
+	}
+	if len(clashes) > 0 {
+		result.Unmet = append(result.Unmet, UnmetClause{Kind: ClauseProhibition, Clause: "NOT " + clashes[0], Units: clashes})
+	}
+
+	if course := checker.prerequisites.Course; unit.ExcludesCourse(course) {
+		result.Unmet = append(result.Unmet, UnmetClause{Kind: ClauseCourseExclusion, Clause: "NOT ENROLLED IN " + course})
+	}
+
+	if unit.Requisites != nil {
+		if unmet := unit.Requisites.PrerequisiteTree.Unmet(checker.prerequisites); unmet != nil {
+			result.Unmet = append(result.Unmet, UnmetClause{Kind: ClausePrerequisite, Clause: unmet.String(), Tree: unmet, Units: unmet.Units()})
+		}
+		if unmet := unit.Requisites.CorequisiteTree.Unmet(checker.corequisites); unmet != nil {
+			result.Unmet = append(result.Unmet, UnmetClause{Kind: ClauseCorequisite, Clause: unmet.String(), Tree: unmet, Units: unmet.Units()})
+		}
+		result.RequiresPermission = unit.Requisites.Permission
+	}
+
+	result.Eligible = len(result.Unmet) == 0
+	return result
+}
+
+// CheckEligibility checks every processed unit the student has not already completed or enrolled in.
+func CheckEligibility(units map[string]*ProcessedUnit, query EligibilityQuery) *EligibilityReport {
+	checker := NewEligibilityChecker(units, query)
+	report := &EligibilityReport{
+		Query:      query,
+		Eligible:   make([]string, 0),
+		Ineligible: make([]*UnitEligibility, 0),
+	}
+
+	unitCodes := make([]string, 0, len(units))
+	for code := range units {
+		unitCodes = append(unitCodes, code)
+	}
+	sort.Strings(unitCodes)
+
+	for _, code := range unitCodes {
+		if checker.taken[code] {
+			continue
+		}
+		result := checker.Check(code)
+		if result.Eligible {
+			report.Eligible = append(report.Eligible, code)
+		} else {
+			report.Ineligible = append(report.Ineligible, result)
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,27 @@
+package process
+
+import "testing"
+
+func TestCheckCourseExclusion(t *testing.T) {
+	requisites := newRefinedRequisite()
+	requisites.ExcludedCourses = []string{"C2000"}
+	units := map[string]*ProcessedUnit{"FIT1045": {Code: "FIT1045", Requisites: requisites}}
+
+	tests := []struct {
+		course string
+		want   bool
+	}{
+		{"", true},
+		{"C2001", true},
+		{"C2000", false},
+	}
+
+	for _, test := range tests {
+		t.Run("course "+test.course, func(t *testing.T) {
+			result := NewEligibilityChecker(units, EligibilityQuery{Course: test.course}).Check("FIT1045")
+			if result.Eligible != test.want {
+				t.Errorf("eligible = %v, want %v (unmet %+v)", result.Eligible, test.want, result.Unmet)
+			}
+		})
+	}
+}
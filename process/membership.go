@@ -0,0 +1,58 @@
+package process
+
+import (
+	"handbook-scraper/format"
+	"sort"
+)
+
+// Reverse index from a unit to the areas of study and courses whose structures name it.
+
+type UnitMembership struct {
+	AOS     []string `json:"aos"`
+	Courses []string `json:"courses"`
+}
+
+// structureUnits lists every unit code referenced anywhere in a formatted record's structure.
+func structureUnits(record map[string]interface{}) []string {
+	structure, err := structureFromRecord(record)
+	if err != nil {
+		return nil
+	}
+	core, elective := format.CoreAndElectiveUnits(format.BuildRequirementTree("", structure))
+	return append(core, elective...)
+}
+
+// BuildUnitMembership indexes the formatted AOS and course collections by unit code.
+func BuildUnitMembership(courses map[string]interface{}, aos map[string]interface{}) map[string]*UnitMembership {
+	membership := make(map[string]*UnitMembership)
+
+	entry := func(unit string) *UnitMembership {
+		if _, exists := membership[unit]; !exists {
+			membership[unit] = &UnitMembership{AOS: make([]string, 0), Courses: make([]string, 0)}
+		}
+		return membership[unit]
+	}
+
+	for code, raw := range aos {
+		if record, ok := raw.(map[string]interface{}); ok {
+			for _, unit := range structureUnits(record) {
+				entry(unit).AOS = append(entry(unit).AOS, code)
+			}
+		}
+	}
+
+	for code, raw := range courses {
+		if record, ok := raw.(map[string]interface{}); ok {
+			for _, unit := range structureUnits(record) {
+				entry(unit).Courses = append(entry(unit).Courses, code)
+			}
+		}
+	}
+
+	for _, member := range membership {
+		sort.Strings(member.AOS)
+		sort.Strings(member.Courses)
+	}
+
+	return membership
+}
@@ -0,0 +1,157 @@
+package process
+
+import (
+	"fmt"
+	"handbook-scraper/codes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Grammar for the MonPlan courseErrors a single unit plan produces.
+// Each message title has its own parser; titles without one are reported, not dropped.
+
+const (
+	RuleProhibition  = "prohibition"
+	RulePrerequisite = "prerequisite"
+	RuleCorequisite  = "corequisite"
+	RuleCreditPoints = "credit_points"
+	RulePermission   = "permission"
+)
+
+type ParsedRule struct {
+	Kind         string                  `json:"kind"`
+	NumRequired  int                     `json:"num_required,omitempty"`
+	Units        []string                `json:"units,omitempty"`
+	CreditPoints []CreditPointConstraint `json:"credit_points,omitempty"`
+	Source       RawRequisite            `json:"source"`
+}
+
+type UnrecognisedRule struct {
+	Unit        string `json:"unit"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Reason      string `json:"reason"`
+}
+
+type ruleParser func(unit string, rule RawRequisite, extractor *codeExtractor) (ParsedRule, error)
+
+var (
+	countPattern = regexp.MustCompile(`(?i)\b([0-9]{1,2}|one|two|three|four|five|six|seven|eight|nine|ten|all)\b\s+(?:of|units?|more)`)
+
+	ruleParsers = map[string]ruleParser{
+		"prohibited unit":                      parseUnitList(RuleProhibition),
+		"have not enrolled in a unit":          parseUnitGroup(RuleCorequisite),
+		"have not completed enough units":      parseUnitGroup(RulePrerequisite),
+		"have not passed enough units":         parseUnitGroup(RulePrerequisite),
+		"missing corequisites":                 parseUnitGroup(RuleCorequisite),
+		"not enough passed credit points":      parseCreditPointRule,
+		"not enough enrolled credit points":    parseCreditPointRule,
+		"permission is required for this unit": parsePermission,
+	}
+
+	// Titles that carry no requisite information for a single unit plan
+	ignoredTitles = map[string]bool{
+		"duplicate unit": true,
+	}
+)
+
+func normaliseTitle(title string) string {
+	return strings.ToLower(strings.TrimSpace(title))
+}
+
+// splitMessage separates "You need to pass 1 of: FIT1008, FIT1054" into its count and list halves.
+// Messages without a colon are treated as all list.
+func splitMessage(description string) (string, string) {
+	if idx := strings.Index(description, ":"); idx >= 0 {
+		return description[:idx], description[idx+1:]
+	}
+	return "", description
+}
+
+// parseCount reads how many of the listed units are required, defaulting to one.
+func parseCount(text string, listed int) int {
+	match := countPattern.FindStringSubmatch(text)
+	if match == nil {
+		return 1
+	}
+	word := strings.ToLower(match[1])
+	if word == "all" {
+		return listed
+	}
+	if num, err := strconv.Atoi(word); err == nil && num > 0 {
+		return num
+	}
+	if num, ok := codes.NumberWords[word]; ok {
+		return num
+	}
+	return 1
+}
+
+// withoutSubject drops the unit the message is about from the units it names.
+func withoutSubject(unit string, units []string) []string {
+	filtered := make([]string, 0, len(units))
+	seen := make(map[string]bool)
+	for _, named := range units {
+		if named != unit && !seen[named] {
+			seen[named] = true
+			filtered = append(filtered, named)
+		}
+	}
+	return filtered
+}
+
+func parseUnitList(kind string) ruleParser {
+	return func(unit string, rule RawRequisite, extractor *codeExtractor) (ParsedRule, error) {
+		units := withoutSubject(unit, extractor.getNamedUnits(unit, rule.Description))
+		if len(units) == 0 {
+			return ParsedRule{}, fmt.Errorf("no units named")
+		}
+		return ParsedRule{Kind: kind, Units: units, Source: rule}, nil
+	}
+}
+
+func parseUnitGroup(kind string) ruleParser {
+	return func(unit string, rule RawRequisite, extractor *codeExtractor) (ParsedRule, error) {
+		countMsg, unitsMsg := splitMessage(rule.Description)
+		units := withoutSubject(unit, extractor.getNamedUnits(unit, unitsMsg))
+		if len(units) == 0 {
+			return ParsedRule{}, fmt.Errorf("no units named")
+		}
+		if countMsg == "" {
+			countMsg = rule.Description
+		}
+		numRequired := parseCount(countMsg, len(units))
+		if numRequired > len(units) {
+			numRequired = len(units)
+		}
+		return ParsedRule{Kind: kind, NumRequired: numRequired, Units: units, Source: rule}, nil
+	}
+}
+
+func parseCreditPointRule(unit string, rule RawRequisite, extractor *codeExtractor) (ParsedRule, error) {
+	constraints := ParseCreditPointConstraints(rule.Title, rule.Description)
+	if len(constraints) == 0 {
+		return ParsedRule{}, fmt.Errorf("no credit point amount")
+	}
+	return ParsedRule{Kind: RuleCreditPoints, CreditPoints: constraints, Source: rule}, nil
+}
+
+func parsePermission(unit string, rule RawRequisite, extractor *codeExtractor) (ParsedRule, error) {
+	return ParsedRule{Kind: RulePermission, Source: rule}, nil
+}
+
+// parseRule applies the grammar for a message's title.
+// Returns false for titles that are deliberately ignored.
+func parseRule(unit string, rule RawRequisite, extractor *codeExtractor) (ParsedRule, bool, error) {
+	title := normaliseTitle(rule.Title)
+	if ignoredTitles[title] {
+		return ParsedRule{}, false, nil
+	}
+	parser, ok := ruleParsers[title]
+	if !ok {
+		return ParsedRule{}, true, fmt.Errorf("unrecognised title")
+	}
+	parsed, err := parser(unit, rule, extractor)
+	return parsed, true, err
+}
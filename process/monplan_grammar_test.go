@@ -0,0 +1,132 @@
+package process
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     RawRequisite
+		relevant bool
+		want     ParsedRule
+		err      bool
+	}{
+		{
+			name:     "message without a colon",
+			rule:     RawRequisite{Title: "Have not passed enough units", Description: "You need to pass FIT1008"},
+			relevant: true,
+			want:     ParsedRule{Kind: RulePrerequisite, NumRequired: 1, Units: []string{"FIT1008"}},
+		},
+		{
+			name:     "count before the colon",
+			rule:     RawRequisite{Title: "Have not passed enough units", Description: "You need to pass 2 of the following units: FIT1008, FIT1054, MAT1830"},
+			relevant: true,
+			want:     ParsedRule{Kind: RulePrerequisite, NumRequired: 2, Units: []string{"FIT1008", "FIT1054", "MAT1830"}},
+		},
+		{
+			name:     "spelled out count",
+			rule:     RawRequisite{Title: "Have not passed enough units", Description: "You need to pass two of the following units: FIT1008, FIT1054, MAT1830"},
+			relevant: true,
+			want:     ParsedRule{Kind: RulePrerequisite, NumRequired: 2, Units: []string{"FIT1008", "FIT1054", "MAT1830"}},
+		},
+		{
+			name:     "all of the listed units",
+			rule:     RawRequisite{Title: "Have not passed enough units", Description: "You need to pass all of the following units: FIT1008, MAT1830"},
+			relevant: true,
+			want:     ParsedRule{Kind: RulePrerequisite, NumRequired: 2, Units: []string{"FIT1008", "MAT1830"}},
+		},
+		{
+			name:     "leading spaces in the list",
+			rule:     RawRequisite{Title: "Have not passed enough units", Description: "You need to pass 1 of the following units:  ACB1000,  ACC1100"},
+			relevant: true,
+			want:     ParsedRule{Kind: RulePrerequisite, NumRequired: 1, Units: []string{"ACB1000", "ACC1100"}},
+		},
+		{
+			name:     "enrolment is a corequisite",
+			rule:     RawRequisite{Title: "Have not enrolled in a unit", Description: "You need to enrol in 1 of the following units: FIT1047"},
+			relevant: true,
+			want:     ParsedRule{Kind: RuleCorequisite, NumRequired: 1, Units: []string{"FIT1047"}},
+		},
+		{
+			name:     "prohibition leaves out the unit itself",
+			rule:     RawRequisite{Title: "Prohibited unit", Description: "FIT2004 cannot be taken with FIT1008, FIT1054"},
+			relevant: true,
+			want:     ParsedRule{Kind: RuleProhibition, Units: []string{"FIT1008", "FIT1054"}},
+		},
+		{
+			name:     "credit points with a level qualifier",
+			rule:     RawRequisite{Title: "Not enough passed credit points", Description: "You need at least 48 credit points including 12 at level 2"},
+			relevant: true,
+			want: ParsedRule{Kind: RuleCreditPoints, CreditPoints: []CreditPointConstraint{
+				{Kind: CreditPointsPassed, Amount: 48, Source: "You need at least 48 credit points including 12 at level 2"},
+				{Kind: CreditPointsPassed, Amount: 12, Level: 2, Source: "You need at least 48 credit points including 12 at level 2"},
+			}},
+		},
+		{
+			name:     "enrolled credit points",
+			rule:     RawRequisite{Title: "Not enough enrolled credit points", Description: "You need at least 24 enrolled credit points"},
+			relevant: true,
+			want: ParsedRule{Kind: RuleCreditPoints, CreditPoints: []CreditPointConstraint{
+				{Kind: CreditPointsEnrolled, Amount: 24, Source: "You need at least 24 enrolled credit points"},
+			}},
+		},
+		{
+			name:     "permission",
+			rule:     RawRequisite{Title: "Permission is required for this unit", Description: "Permission is required"},
+			relevant: true,
+			want:     ParsedRule{Kind: RulePermission},
+		},
+		{
+			name:     "duplicate unit is ignored",
+			rule:     RawRequisite{Title: "Duplicate unit", Description: "FIT2004 appears twice"},
+			relevant: false,
+		},
+		{
+			name:     "unrecognised title",
+			rule:     RawRequisite{Title: "Something new", Description: "You need FIT1008"},
+			relevant: true,
+			err:      true,
+		},
+		{
+			name:     "no units named",
+			rule:     RawRequisite{Title: "Have not passed enough units", Description: "You need to pass 1 of the following units:"},
+			relevant: true,
+			err:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, relevant, err := parseRule("FIT2004", test.rule, &codeExtractor{})
+			if relevant != test.relevant {
+				t.Fatalf("relevant = %v, want %v", relevant, test.relevant)
+			}
+			if (err != nil) != test.err {
+				t.Fatalf("err = %v, want error %v", err, test.err)
+			}
+			if err != nil || !relevant {
+				return
+			}
+			test.want.Source = test.rule
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRefineRequisitesEmptyLists(t *testing.T) {
+	refined, unrecognised := refineRequisites(map[string][]RawRequisite{
+		"FIT2004": {{Title: "Something new", Description: "You need FIT1008"}},
+	}, &codeExtractor{})
+
+	if len(unrecognised) != 1 {
+		t.Fatalf("got %d unrecognised rules, want 1", len(unrecognised))
+	}
+	requisite := refined["FIT2004"]
+	if requisite.CreditPoints == nil || requisite.Rules == nil || requisite.Prohibitions == nil {
+		t.Errorf("lists should be empty, not nil: %+v", requisite)
+	}
+}
@@ -0,0 +1,348 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"handbook-scraper/codes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Validates a whole study plan offline against the processed requisites, producing the same
+// courseErrors shape MonPlan returns so the two can be compared message for message.
+// Checks MonPlan has no message for are kept apart as warnings.
+
+// Titles MonPlan uses
+const (
+	TitleProhibitedUnit          = "Prohibited unit"
+	TitleNotPassedEnoughUnits    = "Have not passed enough units"
+	TitleMissingCorequisites     = "Missing corequisites"
+	TitleNotEnoughPassedPoints   = "Not enough passed credit points"
+	TitleNotEnoughEnrolledPoints = "Not enough enrolled credit points"
+	TitlePermissionRequired      = "Permission is required for this unit"
+	TitleDuplicateUnit           = "Duplicate unit"
+
+	levelError   = "error"
+	levelWarning = "warning"
+)
+
+// Titles of the local-only checks
+const (
+	TitleCourseRestriction = "Course restriction"
+	TitleUnitNotOffered    = "Unit not offered in teaching period"
+	TitleUnknownUnit       = "Unknown unit"
+)
+
+type PlanPeriod struct {
+	Code  string   `json:"code" yaml:"code"`
+	Units []string `json:"units" yaml:"units"`
+}
+
+type PlanYear struct {
+	Year    int          `json:"year" yaml:"year"`
+	Periods []PlanPeriod `json:"periods" yaml:"periods"`
+}
+
+// PlanFile is a study plan as written by a student or produced by the planner.
+type PlanFile struct {
+	Course           string     `json:"course" yaml:"course"`
+	StartYear        int        `json:"start_year" yaml:"start_year"`
+	AdvancedStanding []string   `json:"advanced_standing" yaml:"advanced_standing"`
+	CreditPoints     int        `json:"credit_points" yaml:"credit_points"`
+	Years            []PlanYear `json:"years" yaml:"years"`
+}
+
+// PlanValidation is the MonPlan style errors for a plan, and the local-only warnings
+// (unknown units, offerings and course restrictions) that have no MonPlan counterpart.
+type PlanValidation struct {
+	CourseErrors []EnrolmentError `json:"courseErrors"`
+	Warnings     []EnrolmentError `json:"warnings"`
+}
+
+type CourseErrorDiff struct {
+	Matching    []EnrolmentError `json:"matching"`
+	OnlyLocal   []EnrolmentError `json:"only_local"`
+	OnlyMonPlan []EnrolmentError `json:"only_monplan"`
+	Warnings    []EnrolmentError `json:"warnings"`
+}
+
+// LoadPlanFile reads a plan from JSON, or from YAML when the file ends in .yaml or .yml.
+func LoadPlanFile(path string) (*PlanFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &PlanFile{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, plan)
+	default:
+		err = json.Unmarshal(data, plan)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading plan %s: %w", path, err)
+	}
+
+	plan.Course = strings.ToUpper(strings.TrimSpace(plan.Course))
+	for idx := range plan.AdvancedStanding {
+		plan.AdvancedStanding[idx] = codes.Normalise(plan.AdvancedStanding[idx])
+	}
+	for yearIdx := range plan.Years {
+		for periodIdx := range plan.Years[yearIdx].Periods {
+			period := &plan.Years[yearIdx].Periods[periodIdx]
+			period.Code = strings.ToUpper(strings.TrimSpace(period.Code))
+			for idx := range period.Units {
+				period.Units[idx] = codes.Normalise(period.Units[idx])
+			}
+		}
+	}
+	if plan.StartYear == 0 && len(plan.Years) > 0 {
+		plan.StartYear = plan.Years[0].Year
+	}
+	return plan, nil
+}
+
+func courseError(title string, description string, level string, unit string, year int, period string) EnrolmentError {
+	return EnrolmentError{
+		Title:       title,
+		Description: description,
+		Level:       level,
+		Type:        "validation",
+		References:  []References{{UnitCode: unit, TeachingPeriodCode: period, TeachingPeriodStartingYear: year}},
+	}
+}
+
+// offeredInPeriod matches a MonPlan teaching period code such as "S1-01" against the
+// offering names, which start with the same code, e.g. "S1-01-CLAYTON-ON-CAMPUS".
+func offeredInPeriod(unit *ProcessedUnit, code string) bool {
+	for _, offering := range unit.Offerings {
+		if name, _ := offering["name"].(string); strings.HasPrefix(strings.ToUpper(name), code+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// clauses splits an unmet tree into the separate messages MonPlan would give, one per AND child.
+func clauses(node *RequisiteNode) []*RequisiteNode {
+	if node == nil {
+		return nil
+	}
+	if node.Op == OpAnd {
+		return node.Children
+	}
+	return []*RequisiteNode{node}
+}
+
+// describeUnits phrases a unit clause the way MonPlan does, so the grammar can read it back.
+func describeUnits(verb string, clause *RequisiteNode) string {
+	units := clause.Units()
+	switch {
+	case clause.Op == OpUnit:
+		return fmt.Sprintf("You need to %s all of the following units: %s", verb, clause.Unit)
+	case clause.Op == OpOr && len(units) == len(clause.Children):
+		return fmt.Sprintf("You need to %s 1 of the following units: %s", verb, strings.Join(units, ", "))
+	case clause.Op == OpNOf && len(units) == len(clause.Children):
+		return fmt.Sprintf("You need to %s %d of the following units: %s", verb, clause.N, strings.Join(units, ", "))
+	}
+	return fmt.Sprintf("You need to %s: %s", verb, clause.String())
+}
+
+func describeCreditPoints(clause *RequisiteNode) string {
+	text := fmt.Sprintf("You need at least %d credit points", clause.CreditPoints)
+	if clause.Level > 0 {
+		text += fmt.Sprintf(" at level %d", clause.Level)
+		if clause.LevelOrAbove {
+			text += " or above"
+		}
+	}
+	if clause.Discipline != "" {
+		text += " in " + clause.Discipline
+	}
+	return text
+}
+
+// ValidatePlan checks every unit of a plan against the units completed in earlier periods.
+// Course restrictions are only checked when the plan names a course.
+func ValidatePlan(units map[string]*ProcessedUnit, plan *PlanFile) *PlanValidation {
+	errors := make([]EnrolmentError, 0)
+	warnings := make([]EnrolmentError, 0)
+
+	unitCreditPoints := make(map[string]int)
+	for code, unit := range units {
+		unitCreditPoints[code] = unit.Points()
+	}
+
+	completed := make(map[string]bool)
+	for _, code := range plan.AdvancedStanding {
+		completed[code] = true
+	}
+
+	// Prohibitions apply in either order, so collect every unit the plan mentions
+	inPlan := make(map[string]bool)
+	for code := range completed {
+		inPlan[code] = true
+	}
+	for _, year := range plan.Years {
+		for _, period := range year.Periods {
+			for _, code := range period.Units {
+				inPlan[code] = true
+			}
+		}
+	}
+
+	earned := 0
+	for code := range completed {
+		earned += unitCreditPoints[code]
+	}
+
+	for _, year := range plan.Years {
+		for _, period := range year.Periods {
+			enrolled := make(map[string]bool)
+			for _, code := range period.Units {
+				if completed[code] || enrolled[code] {
+					errors = append(errors, courseError(TitleDuplicateUnit, code+" appears more than once in the plan", levelError, code, year.Year, period.Code))
+				}
+				enrolled[code] = true
+			}
+
+			context := &EvalContext{
+				Completed:        completed,
+				Enrolled:         enrolled,
+				UnitCreditPoints: unitCreditPoints,
+				Course:           plan.Course,
+			}
+			if plan.CreditPoints > 0 {
+				context.CreditPoints = plan.CreditPoints + earned
+			}
+			withPeriod := &EvalContext{Completed: make(map[string]bool), Course: plan.Course}
+			for code := range completed {
+				withPeriod.Completed[code] = true
+			}
+			for code := range enrolled {
+				withPeriod.Completed[code] = true
+			}
+
+			for _, code := range codes.UniqueSorted(period.Units) {
+				unit, ok := units[code]
+				if !ok {
+					warnings = append(warnings, courseError(TitleUnknownUnit, code+" is not in the processed handbook", levelError, code, year.Year, period.Code))
+					continue
+				}
+
+				if len(unit.Offerings) > 0 && !offeredInPeriod(unit, period.Code) {
+					warnings = append(warnings, courseError(TitleUnitNotOffered, fmt.Sprintf("%s is not offered in %s", code, period.Code), levelWarning, code, year.Year, period.Code))
+				}
+
+				clashing := make([]string, 0)
+				for _, prohibited := range prohibitedUnits(unit) {
+					if inPlan[prohibited] {
+						clashing = append(clashing, prohibited)
+					}
+				}
+				if len(clashing) > 0 {
+					errors = append(errors, courseError(TitleProhibitedUnit, "You cannot take this unit with: "+strings.Join(clashing, ", "), levelError, code, year.Year, period.Code))
+				}
+
+				if unit.Requisites == nil {
+					continue
+				}
+				if unit.ExcludesCourse(plan.Course) {
+					warnings = append(warnings, courseError(TitleCourseRestriction, "This unit is not available to students in: "+plan.Course, levelError, code, year.Year, period.Code))
+				}
+				if unit.Requisites.Permission {
+					errors = append(errors, courseError(TitlePermissionRequired, "Permission is required to enrol in "+code, levelWarning, code, year.Year, period.Code))
+				}
+
+				for _, clause := range clauses(unit.Requisites.PrerequisiteTree.Unmet(context)) {
+					switch {
+					case clause.Op == OpCreditPoints && clause.Enrolled:
+						errors = append(errors, courseError(TitleNotEnoughEnrolledPoints, describeCreditPoints(clause), levelError, code, year.Year, period.Code))
+					case clause.Op == OpCreditPoints:
+						errors = append(errors, courseError(TitleNotEnoughPassedPoints, describeCreditPoints(clause), levelError, code, year.Year, period.Code))
+					case clause.Op == OpCourse || len(clause.Units()) == 0:
+						if plan.Course != "" {
+							warnings = append(warnings, courseError(TitleCourseRestriction, "You need to be enrolled in: "+clause.String(), levelError, code, year.Year, period.Code))
+						}
+					default:
+						errors = append(errors, courseError(TitleNotPassedEnoughUnits, describeUnits("pass", clause), levelError, code, year.Year, period.Code))
+					}
+				}
+				for _, clause := range clauses(unit.Requisites.CorequisiteTree.Unmet(withPeriod)) {
+					errors = append(errors, courseError(TitleMissingCorequisites, describeUnits("enrol in", clause), levelError, code, year.Year, period.Code))
+				}
+			}
+
+			// Units count as completed from the next period on
+			next := make(map[string]bool)
+			for code := range completed {
+				next[code] = true
+			}
+			for code := range enrolled {
+				next[code] = true
+				earned += unitCreditPoints[code]
+			}
+			completed = next
+		}
+	}
+
+	return &PlanValidation{CourseErrors: errors, Warnings: warnings}
+}
+
+func courseErrorKey(courseError EnrolmentError) string {
+	reference := References{}
+	if len(courseError.References) > 0 {
+		reference = courseError.References[0]
+	}
+	return fmt.Sprintf("%s|%s|%d|%s", normaliseTitle(courseError.Title), reference.UnitCode, reference.TeachingPeriodStartingYear, reference.TeachingPeriodCode)
+}
+
+// DiffCourseErrors pairs local and MonPlan messages by title, unit and teaching period.
+// Descriptions are not compared since the wording differs between the two.
+// The local warnings are carried over as they are, outside the comparison.
+func DiffCourseErrors(validation *PlanValidation, monplan []EnrolmentError) *CourseErrorDiff {
+	local := validation.CourseErrors
+	diff := &CourseErrorDiff{
+		Matching:    make([]EnrolmentError, 0),
+		OnlyLocal:   make([]EnrolmentError, 0),
+		OnlyMonPlan: make([]EnrolmentError, 0),
+		Warnings:    validation.Warnings,
+	}
+
+	remote := make(map[string]int)
+	for _, courseError := range monplan {
+		remote[courseErrorKey(courseError)]++
+	}
+	for _, courseError := range local {
+		key := courseErrorKey(courseError)
+		if remote[key] > 0 {
+			remote[key]--
+			diff.Matching = append(diff.Matching, courseError)
+		} else {
+			diff.OnlyLocal = append(diff.OnlyLocal, courseError)
+		}
+	}
+
+	localKeys := make(map[string]int)
+	for _, courseError := range local {
+		localKeys[courseErrorKey(courseError)]++
+	}
+	for _, courseError := range monplan {
+		key := courseErrorKey(courseError)
+		if localKeys[key] > 0 {
+			localKeys[key]--
+		} else {
+			diff.OnlyMonPlan = append(diff.OnlyMonPlan, courseError)
+		}
+	}
+
+	sort.SliceStable(diff.OnlyMonPlan, func(i, j int) bool {
+		return courseErrorKey(diff.OnlyMonPlan[i]) < courseErrorKey(diff.OnlyMonPlan[j])
+	})
+	return diff
+}
@@ -0,0 +1,110 @@
+package process
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// validationUnits: FIT2004 needs FIT1008, FIT2099 needs FIT2004 alongside it, and FIT1045 and
+// FIT1053 cannot both be taken.
+func validationUnits() map[string]*ProcessedUnit {
+	units := map[string]*ProcessedUnit{
+		"FIT1008": requisiteUnit("FIT1008", nil),
+		"FIT2004": requisiteUnit("FIT2004", UnitNode("FIT1008")),
+		"FIT2099": requisiteUnit("FIT2099", nil),
+		"FIT1045": requisiteUnit("FIT1045", nil),
+		"FIT1053": requisiteUnit("FIT1053", nil),
+	}
+	units["FIT2099"].Requisites.CorequisiteTree = UnitNode("FIT2004")
+	units["FIT1053"].Requisites.Prohibitions = []string{"FIT1045"}
+	units["FIT1045"].ProhibitedBy = []string{"FIT1053"}
+	return units
+}
+
+// twoPeriods is a 2024 plan with the given units in first and second semester.
+func twoPeriods(first []string, second []string, advancedStanding ...string) *PlanFile {
+	return &PlanFile{
+		StartYear:        2024,
+		AdvancedStanding: advancedStanding,
+		Years: []PlanYear{{Year: 2024, Periods: []PlanPeriod{
+			{Code: "S1-01", Units: first},
+			{Code: "S2-01", Units: second},
+		}}},
+	}
+}
+
+func errorKeys(courseErrors []EnrolmentError) []string {
+	keys := make([]string, 0, len(courseErrors))
+	for _, courseError := range courseErrors {
+		reference := courseError.References[0]
+		keys = append(keys, fmt.Sprintf("%s %s %s", courseError.Title, reference.UnitCode, reference.TeachingPeriodCode))
+	}
+	return keys
+}
+
+func TestValidatePlan(t *testing.T) {
+	tests := []struct {
+		name string
+		plan *PlanFile
+		want []string
+	}{
+		{"prerequisite in an earlier period", twoPeriods([]string{"FIT1008"}, []string{"FIT2004"}), []string{}},
+		{"prerequisite in advanced standing", twoPeriods([]string{"FIT2004"}, nil, "FIT1008"), []string{}},
+		{"prerequisite taken too late", twoPeriods([]string{"FIT2004"}, []string{"FIT1008"}), []string{"Have not passed enough units FIT2004 S1-01"}},
+		{"prerequisite in the same period", twoPeriods([]string{"FIT1008", "FIT2004"}, nil), []string{"Have not passed enough units FIT2004 S1-01"}},
+		{"prohibited pair in different periods", twoPeriods([]string{"FIT1045"}, []string{"FIT1053"}), []string{"Prohibited unit FIT1045 S1-01", "Prohibited unit FIT1053 S2-01"}},
+		{"corequisite in the same period", twoPeriods([]string{"FIT2004", "FIT2099"}, nil, "FIT1008"), []string{}},
+		{"missing corequisite", twoPeriods([]string{"FIT2099"}, []string{"FIT2004"}, "FIT1008"), []string{"Missing corequisites FIT2099 S1-01"}},
+		{"unit repeated", twoPeriods([]string{"FIT1008"}, []string{"FIT1008"}), []string{"Duplicate unit FIT1008 S2-01"}},
+	}
+
+	units := validationUnits()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validation := ValidatePlan(units, test.plan)
+			if got := errorKeys(validation.CourseErrors); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidatePlanWarnings(t *testing.T) {
+	units := validationUnits()
+	units["FIT1008"].Offerings = []map[string]interface{}{{"name": "S2-01-CLAYTON-ON-CAMPUS"}}
+	units["FIT1045"].Requisites.ExcludedCourses = []string{"C2000"}
+
+	plan := twoPeriods([]string{"FIT1008", "FIT1045"}, []string{"FIT1008X"})
+	plan.Course = "C2000"
+
+	validation := ValidatePlan(units, plan)
+	want := []string{"Unit not offered in teaching period FIT1008 S1-01", "Course restriction FIT1045 S1-01", "Unknown unit FIT1008X S2-01"}
+	if got := errorKeys(validation.Warnings); !reflect.DeepEqual(got, want) {
+		t.Errorf("warnings %v, want %v", got, want)
+	}
+	if len(validation.CourseErrors) != 0 {
+		t.Errorf("errors %v, want none", errorKeys(validation.CourseErrors))
+	}
+}
+
+func TestDiffCourseErrors(t *testing.T) {
+	validation := ValidatePlan(validationUnits(), twoPeriods([]string{"FIT2004", "FIT1045"}, []string{"FIT1053"}))
+	monplan := []EnrolmentError{
+		// Same title, unit and period in MonPlan's own wording
+		courseError("Have not passed enough units", "You need to pass all of the following units: FIT1008", levelError, "FIT2004", 2024, "S1-01"),
+		courseError("Prohibited unit", "FIT1053 is prohibited", levelError, "FIT1053", 2024, "S2-01"),
+		courseError("Not enough passed credit points", "You need at least 24 credit points", levelError, "FIT1053", 2024, "S2-01"),
+	}
+
+	diff := DiffCourseErrors(validation, monplan)
+	if got, want := errorKeys(diff.Matching), []string{"Have not passed enough units FIT2004 S1-01", "Prohibited unit FIT1053 S2-01"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("matching %v, want %v", got, want)
+	}
+	if got, want := errorKeys(diff.OnlyLocal), []string{"Prohibited unit FIT1045 S1-01"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("only local %v, want %v", got, want)
+	}
+	if got, want := errorKeys(diff.OnlyMonPlan), []string{"Not enough passed credit points FIT1053 S2-01"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("only MonPlan %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,406 @@
+package process
+
+import (
+	"fmt"
+	"handbook-scraper/codes"
+	"sort"
+	"strings"
+)
+
+// Builds a semester by semester study plan for a set of desired units.
+// Units are placed greedily, longest remaining prerequisite chain first, into alternating
+// first and second semesters. A unit is placed only when its prerequisites were completed in an
+// earlier semester, its corequisites are completed or placed in the same semester, it does not
+// clash with a prohibited unit, and it is offered in that teaching period.
+
+const (
+	PeriodFirstSemester  = "First semester"
+	PeriodSecondSemester = "Second semester"
+
+	DefaultSemesterLoad = 24
+	DefaultMaxSemesters = 12
+)
+
+type PlanRequest struct {
+	Course       string   `json:"course"`
+	Completed    []string `json:"completed"`
+	Desired      []string `json:"desired"`
+	Load         int      `json:"credit_points_per_semester"`
+	CreditPoints int      `json:"credit_points,omitempty"`
+	StartPeriod  string   `json:"start_period"`
+	MaxSemesters int      `json:"max_semesters"`
+}
+
+type PlannedSemester struct {
+	Number       int      `json:"number"`
+	Year         int      `json:"year"`
+	Period       string   `json:"period"`
+	Units        []string `json:"units"`
+	CreditPoints int      `json:"credit_points"`
+}
+
+type UnplannedUnit struct {
+	Unit    string   `json:"unit"`
+	Reasons []string `json:"reasons"`
+}
+
+type StudyPlan struct {
+	Request   PlanRequest       `json:"request"`
+	Feasible  bool              `json:"feasible"`
+	Semesters []PlannedSemester `json:"semesters"`
+	Added     []string          `json:"added_prerequisites"`
+	Unplanned []UnplannedUnit   `json:"unplanned"`
+}
+
+type planner struct {
+	units   map[string]*ProcessedUnit
+	request PlanRequest
+	context *EvalContext
+	planned map[string]bool
+}
+
+// offeredIn reports whether a unit has an offering in the given teaching period.
+func offeredIn(unit *ProcessedUnit, period string) bool {
+	for _, offering := range unit.Offerings {
+		if name, _ := offering["period"].(string); strings.EqualFold(name, period) {
+			return true
+		}
+	}
+	return false
+}
+
+func offeredPeriods(unit *ProcessedUnit) []string {
+	periods := make([]string, 0)
+	for _, offering := range unit.Offerings {
+		if name, _ := offering["period"].(string); name != "" {
+			periods = append(periods, name)
+		}
+	}
+	return codes.UniqueSorted(periods)
+}
+
+// requiredUnits lists the unit leaves of a tree that must be taken whatever alternatives are chosen.
+func requiredUnits(node *RequisiteNode) []string {
+	if node == nil {
+		return nil
+	}
+	switch node.Op {
+	case OpUnit:
+		return []string{node.Unit}
+	case OpAnd:
+		units := make([]string, 0)
+		for _, child := range node.Children {
+			units = append(units, requiredUnits(child)...)
+		}
+		return units
+	}
+	return nil
+}
+
+// addRequiredPrerequisites grows the desired set with prerequisites that are not optional,
+// e.g. desiring FIT3155 adds FIT2004 unless it is already completed.
+func (p *planner) addRequiredPrerequisites(desired map[string]bool) []string {
+	added := make([]string, 0)
+	queue := codes.Sorted(desired)
+
+	for len(queue) > 0 {
+		code := queue[0]
+		queue = queue[1:]
+		unit, ok := p.units[code]
+		if !ok || unit.Requisites == nil {
+			continue
+		}
+
+		for _, tree := range []*RequisiteNode{unit.Requisites.PrerequisiteTree, unit.Requisites.CorequisiteTree} {
+			for _, required := range requiredUnits(tree.Unmet(p.context)) {
+				if desired[required] || p.context.Completed[required] {
+					continue
+				}
+				if _, known := p.units[required]; !known {
+					continue
+				}
+				desired[required] = true
+				added = append(added, required)
+				queue = append(queue, required)
+			}
+		}
+	}
+
+	sort.Strings(added)
+	return added
+}
+
+// chainLengths counts, for each desired unit, how many other desired units depend on it.
+// Units at the start of long chains are placed first.
+func (p *planner) chainLengths(desired map[string]bool) map[string]int {
+	lengths := make(map[string]int)
+	var count func(code string, seen map[string]bool) int
+	count = func(code string, seen map[string]bool) int {
+		total := 0
+		unit, ok := p.units[code]
+		if !ok {
+			return 0
+		}
+		for _, next := range unit.Unlocks {
+			if desired[next] && !seen[next] {
+				seen[next] = true
+				total += 1 + count(next, seen)
+			}
+		}
+		return total
+	}
+	for code := range desired {
+		lengths[code] = count(code, map[string]bool{code: true})
+	}
+	return lengths
+}
+
+func (p *planner) clashes(unit *ProcessedUnit, semester map[string]bool) []string {
+	clashing := make([]string, 0)
+	for _, prohibited := range prohibitedUnits(unit) {
+		if p.context.Completed[prohibited] || semester[prohibited] {
+			clashing = append(clashing, prohibited)
+		}
+	}
+	return clashing
+}
+
+// fillSemester picks units for one semester and drops any whose corequisites end up unmet.
+func (p *planner) fillSemester(order []string, period string) []string {
+	selected := make(map[string]bool)
+	load := 0
+
+	fits := func(code string) bool {
+		unit := p.units[code]
+		return !p.planned[code] && !selected[code] &&
+			load+unit.Points() <= p.request.Load &&
+			offeredIn(unit, period) &&
+			len(p.clashes(unit, selected)) == 0 &&
+			(unit.Requisites == nil || unit.Requisites.PrerequisiteTree.EvaluateWith(p.context))
+	}
+	corequisitesMet := func(code string) bool {
+		unit := p.units[code]
+		if unit.Requisites == nil || unit.Requisites.CorequisiteTree == nil {
+			return true
+		}
+		withSemester := &EvalContext{Completed: make(map[string]bool), Course: p.context.Course}
+		for done := range p.context.Completed {
+			withSemester.Completed[done] = true
+		}
+		for chosen := range selected {
+			withSemester.Completed[chosen] = true
+		}
+		return unit.Requisites.CorequisiteTree.EvaluateWith(withSemester)
+	}
+
+	for _, code := range order {
+		if fits(code) {
+			selected[code] = true
+			load += p.units[code].Points()
+		}
+	}
+
+	// Drop units whose corequisites did not make it into the semester, then try to refill
+	for changed, rounds := true, 0; changed && rounds < len(order); rounds++ {
+		changed = false
+		for _, code := range order {
+			if selected[code] && !corequisitesMet(code) {
+				delete(selected, code)
+				load -= p.units[code].Points()
+				changed = true
+			}
+		}
+		if changed {
+			for _, code := range order {
+				if fits(code) {
+					selected[code] = true
+					load += p.units[code].Points()
+					if !corequisitesMet(code) {
+						delete(selected, code)
+						load -= p.units[code].Points()
+					}
+				}
+			}
+		}
+	}
+
+	return codes.Sorted(selected)
+}
+
+// explain says why a unit could not be placed, checked against the state at the end of the plan.
+func (p *planner) explain(code string) []string {
+	unit, ok := p.units[code]
+	if !ok {
+		return []string{"unit is not in the processed data"}
+	}
+
+	reasons := make([]string, 0)
+	if !offeredIn(unit, PeriodFirstSemester) && !offeredIn(unit, PeriodSecondSemester) {
+		periods := offeredPeriods(unit)
+		if len(periods) == 0 {
+			reasons = append(reasons, "not offered in any teaching period")
+		} else {
+			reasons = append(reasons, "not offered in first or second semester (offered in "+strings.Join(periods, ", ")+")")
+		}
+	}
+	if clashing := p.clashes(unit, nil); len(clashing) > 0 {
+		reasons = append(reasons, "prohibited with "+strings.Join(clashing, ", "))
+	}
+	if unit.Analysis != nil && unit.Analysis.Cycle == CyclePrerequisite {
+		reasons = append(reasons, "part of a prerequisite cycle")
+	}
+	if unit.Requisites != nil {
+		if unmet := unit.Requisites.PrerequisiteTree.Unmet(p.context); unmet != nil {
+			reasons = append(reasons, "prerequisite not met: "+unmet.String())
+		}
+		if unmet := unit.Requisites.CorequisiteTree.Unmet(p.context); unmet != nil {
+			reasons = append(reasons, "corequisite not met: "+unmet.String())
+		}
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, fmt.Sprintf("did not fit in %d semesters of %d credit points", p.request.MaxSemesters, p.request.Load))
+	}
+	return reasons
+}
+
+// PlanStudy lays the desired units out over semesters, adding prerequisites that cannot be avoided.
+// Units that cannot be placed are returned in Unplanned with the reasons, and the plan is not feasible.
+func PlanStudy(units map[string]*ProcessedUnit, request PlanRequest) *StudyPlan {
+	if request.Load <= 0 {
+		request.Load = DefaultSemesterLoad
+	}
+	if request.MaxSemesters <= 0 {
+		request.MaxSemesters = DefaultMaxSemesters
+	}
+	if request.StartPeriod == "" {
+		request.StartPeriod = PeriodFirstSemester
+	}
+
+	p := &planner{
+		units:   units,
+		request: request,
+		context: &EvalContext{
+			Completed:        make(map[string]bool),
+			UnitCreditPoints: make(map[string]int),
+			Course:           request.Course,
+		},
+		planned: make(map[string]bool),
+	}
+	for code, unit := range units {
+		p.context.UnitCreditPoints[code] = unit.Points()
+	}
+	for _, code := range request.Completed {
+		p.context.Completed[code] = true
+	}
+
+	plan := &StudyPlan{
+		Request:   request,
+		Semesters: make([]PlannedSemester, 0),
+		Unplanned: make([]UnplannedUnit, 0),
+	}
+
+	desired := make(map[string]bool)
+	for _, code := range request.Desired {
+		if !p.context.Completed[code] {
+			desired[code] = true
+		}
+	}
+	plan.Added = p.addRequiredPrerequisites(desired)
+
+	lengths := p.chainLengths(desired)
+	order := make([]string, 0, len(desired))
+	for code := range desired {
+		if _, ok := units[code]; ok {
+			order = append(order, code)
+		}
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if lengths[order[i]] != lengths[order[j]] {
+			return lengths[order[i]] > lengths[order[j]]
+		}
+		return order[i] < order[j]
+	})
+
+	periods := []string{PeriodFirstSemester, PeriodSecondSemester}
+	offset := 0
+	if strings.EqualFold(request.StartPeriod, PeriodSecondSemester) {
+		offset = 1
+	}
+
+	earned := 0
+	idle := 0
+	for number := 1; number <= request.MaxSemesters && len(p.planned) < len(order); number++ {
+		if request.CreditPoints > 0 {
+			p.context.CreditPoints = request.CreditPoints + earned
+		}
+		period := periods[(number-1+offset)%len(periods)]
+		chosen := p.fillSemester(order, period)
+
+		semester := PlannedSemester{
+			Number: number,
+			Year:   (number-1+offset)/len(periods) + 1,
+			Period: period,
+			Units:  chosen,
+		}
+		for _, code := range chosen {
+			semester.CreditPoints += units[code].Points()
+		}
+		plan.Semesters = append(plan.Semesters, semester)
+
+		// Both periods passed without progress, nothing more can be placed
+		if len(chosen) == 0 {
+			idle++
+			if idle == len(periods) {
+				break
+			}
+			continue
+		}
+		idle = 0
+
+		for _, code := range chosen {
+			p.planned[code] = true
+			p.context.Completed[code] = true
+		}
+		earned += semester.CreditPoints
+	}
+
+	// Trailing empty semesters say nothing about the plan
+	for len(plan.Semesters) > 0 && len(plan.Semesters[len(plan.Semesters)-1].Units) == 0 {
+		plan.Semesters = plan.Semesters[:len(plan.Semesters)-1]
+	}
+
+	unplanned := make([]string, 0)
+	for code := range desired {
+		if !p.planned[code] {
+			unplanned = append(unplanned, code)
+		}
+	}
+	sort.Strings(unplanned)
+	for _, code := range unplanned {
+		plan.Unplanned = append(plan.Unplanned, UnplannedUnit{Unit: code, Reasons: p.explain(code)})
+	}
+
+	plan.Feasible = len(plan.Unplanned) == 0
+	return plan
+}
+
+// FormatStudyPlan renders a study plan as plain text, one line per semester.
+func FormatStudyPlan(plan *StudyPlan) string {
+	var builder strings.Builder
+	if plan.Request.Course != "" {
+		fmt.Fprintf(&builder, "Study plan for %s\n", plan.Request.Course)
+	}
+	for _, semester := range plan.Semesters {
+		fmt.Fprintf(&builder, "Year %d, %s (%d CP): %s\n", semester.Year, semester.Period, semester.CreditPoints, strings.Join(semester.Units, ", "))
+	}
+	if len(plan.Added) > 0 {
+		fmt.Fprintf(&builder, "Added required prerequisites: %s\n", strings.Join(plan.Added, ", "))
+	}
+	if !plan.Feasible {
+		builder.WriteString("No plan fits every unit:\n")
+		for _, unplanned := range plan.Unplanned {
+			fmt.Fprintf(&builder, "  %s: %s\n", unplanned.Unit, strings.Join(unplanned.Reasons, "; "))
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,120 @@
+package process
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// offeredUnit is a 6 credit point unit offered in the given teaching periods.
+func offeredUnit(code string, prerequisites *RequisiteNode, periods ...string) *ProcessedUnit {
+	unit := requisiteUnit(code, prerequisites)
+	unit.CreditPoints = "6"
+	for _, period := range periods {
+		unit.Offerings = append(unit.Offerings, map[string]interface{}{"period": period})
+	}
+	return unit
+}
+
+// semesterOf maps every planned unit to the number of its semester.
+func semesterOf(plan *StudyPlan) map[string]int {
+	placed := make(map[string]int)
+	for _, semester := range plan.Semesters {
+		for _, unit := range semester.Units {
+			placed[unit] = semester.Number
+		}
+	}
+	return placed
+}
+
+func TestPlanStudyCreditPointCap(t *testing.T) {
+	units := make(map[string]*ProcessedUnit)
+	desired := []string{"ATS1001", "ATS1002", "ATS1003", "ATS1004", "ATS1005"}
+	for _, code := range desired {
+		units[code] = offeredUnit(code, nil, PeriodFirstSemester, PeriodSecondSemester)
+	}
+
+	tests := []struct {
+		load      int
+		semesters int
+	}{
+		{12, 3},
+		{18, 2},
+		{30, 1},
+	}
+
+	for _, test := range tests {
+		plan := PlanStudy(units, PlanRequest{Desired: desired, Load: test.load})
+		if !plan.Feasible || len(plan.Semesters) != test.semesters {
+			t.Errorf("load %d: feasible %v over %d semesters, want %d", test.load, plan.Feasible, len(plan.Semesters), test.semesters)
+		}
+		for _, semester := range plan.Semesters {
+			if semester.CreditPoints > test.load {
+				t.Errorf("load %d: semester %d has %d credit points", test.load, semester.Number, semester.CreditPoints)
+			}
+		}
+	}
+}
+
+func TestPlanStudyPrerequisiteOrder(t *testing.T) {
+	both := []string{PeriodFirstSemester, PeriodSecondSemester}
+	units := map[string]*ProcessedUnit{
+		"FIT1008": offeredUnit("FIT1008", nil, both...),
+		"FIT2004": offeredUnit("FIT2004", UnitNode("FIT1008"), both...),
+		"FIT3155": offeredUnit("FIT3155", UnitNode("FIT2004"), both...),
+		"FIT2014": offeredUnit("FIT2014", OrNode(UnitNode("FIT1008"), UnitNode("FIT1058")), both...),
+	}
+
+	plan := PlanStudy(units, PlanRequest{Desired: []string{"FIT3155", "FIT2014"}})
+	if !plan.Feasible {
+		t.Fatalf("plan not feasible: %+v", plan.Unplanned)
+	}
+	// FIT1008 is only one of FIT2014's alternatives, but FIT2004 needs it
+	if !reflect.DeepEqual(plan.Added, []string{"FIT1008", "FIT2004"}) {
+		t.Errorf("added %v, want FIT1008 and FIT2004", plan.Added)
+	}
+	placed := semesterOf(plan)
+	for _, pair := range [][2]string{{"FIT1008", "FIT2004"}, {"FIT2004", "FIT3155"}, {"FIT1008", "FIT2014"}} {
+		if placed[pair[0]] >= placed[pair[1]] {
+			t.Errorf("%s in semester %d, but %s needs it and is in semester %d", pair[0], placed[pair[0]], pair[1], placed[pair[1]])
+		}
+	}
+
+	// A completed prerequisite is not added again
+	plan = PlanStudy(units, PlanRequest{Completed: []string{"FIT1008"}, Desired: []string{"FIT3155"}})
+	if !reflect.DeepEqual(plan.Added, []string{"FIT2004"}) || semesterOf(plan)["FIT2004"] != 1 {
+		t.Errorf("added %v, placed %v, want FIT2004 in semester 1", plan.Added, semesterOf(plan))
+	}
+}
+
+func TestPlanStudyOfferingPeriods(t *testing.T) {
+	units := map[string]*ProcessedUnit{
+		"FIT1045": offeredUnit("FIT1045", nil, PeriodFirstSemester),
+		"FIT1047": offeredUnit("FIT1047", nil, PeriodSecondSemester),
+		"FIT1049": offeredUnit("FIT1049", nil, "Summer semester A"),
+	}
+
+	tests := []struct {
+		name   string
+		start  string
+		placed map[string]int
+	}{
+		{"starting in first semester", PeriodFirstSemester, map[string]int{"FIT1045": 1, "FIT1047": 2}},
+		{"starting in second semester", PeriodSecondSemester, map[string]int{"FIT1047": 1, "FIT1045": 2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan := PlanStudy(units, PlanRequest{Desired: []string{"FIT1045", "FIT1047", "FIT1049"}, StartPeriod: test.start})
+			if got := semesterOf(plan); !reflect.DeepEqual(got, test.placed) {
+				t.Errorf("placed %v, want %v", got, test.placed)
+			}
+			if plan.Feasible || len(plan.Unplanned) != 1 || plan.Unplanned[0].Unit != "FIT1049" {
+				t.Fatalf("unplanned %+v, want only FIT1049", plan.Unplanned)
+			}
+			if reason := strings.Join(plan.Unplanned[0].Reasons, "; "); !strings.Contains(reason, "offered in Summer semester A") {
+				t.Errorf("reasons %q should name the periods FIT1049 is offered in", reason)
+			}
+		})
+	}
+}
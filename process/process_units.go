@@ -4,16 +4,10 @@ package process
 
 import (
 	"encoding/json"
-	"log"
-	"os"
-	"regexp"
-	"strconv"
-	"strings"
-)
-
-var (
-	unitPattern = regexp.MustCompile(`[A-Z]{3}[0-9]{4}`)
-	numPattern  = regexp.MustCompile(`[0-9]{1,3}`)
+	"errors"
+	"fmt"
+	"handbook-scraper/codes"
+	"sort"
 )
 
 type References struct {
@@ -40,138 +34,157 @@ type RawRequisite struct {
 }
 
 type RefinedRequisite struct {
-	Permission    bool                     `json:"permission"`
-	Prohibitions  []string                 `json:"prohibitions"`
-	Corequisites  []map[string]interface{} `json:"corequisites"`
-	Prerequisites []map[string]interface{} `json:"prerequisites"`
-	CPRequired    int                      `json:"cp_required"`
+	Permission             bool                     `json:"permission"`
+	Prohibitions           []string                 `json:"prohibitions"`
+	Corequisites           []map[string]interface{} `json:"corequisites"`
+	Prerequisites          []map[string]interface{} `json:"prerequisites"`
+	CreditPoints           []CreditPointConstraint  `json:"credit_points"`
+	PrerequisiteTree       *RequisiteNode           `json:"prerequisite_tree"`
+	CorequisiteTree        *RequisiteNode           `json:"corequisite_tree"`
+	PrerequisiteExpression string                   `json:"prerequisite_expression"`
+	CorequisiteExpression  string                   `json:"corequisite_expression"`
+	Rules                  []ParsedRule             `json:"rules"`
+	ExcludedCourses        []string                 `json:"excluded_courses"`
 }
 
-func getNumberFromMsg(msg string) int {
-	numStr := numPattern.FindString(msg)
-	if numStr != "" {
-		num, _ := strconv.Atoi(numStr)
-		return num
+// newRefinedRequisite starts a unit's requisites with every list empty rather than null.
+func newRefinedRequisite() *RefinedRequisite {
+	return &RefinedRequisite{
+		Prohibitions:    make([]string, 0),
+		Corequisites:    make([]map[string]interface{}, 0),
+		Prerequisites:   make([]map[string]interface{}, 0),
+		CreditPoints:    make([]CreditPointConstraint, 0),
+		Rules:           make([]ParsedRule, 0),
+		ExcludedCourses: make([]string, 0),
 	}
-	return 0
 }
 
-func getNamedUnits(msg string) []string {
-	return unitPattern.FindAllString(msg, -1)
+// codeExtractor pulls unit codes out of MonPlan messages, keeping those missing from the index aside.
+type codeExtractor struct {
+	index   *codes.Index
+	unknown []codes.UnknownCodes
+}
+
+func (extractor *codeExtractor) getNamedUnits(unit string, msg string) []string {
+	known, missing := extractor.index.Extract(msg)
+	if len(missing) > 0 {
+		extractor.unknown = append(extractor.unknown, codes.UnknownCodes{Item: unit, Codes: missing, Text: msg})
+	}
+	return known
 }
 
-func rulesToRequisites(rules Rule) map[string][]RawRequisite {
+// rulesToRequisites groups MonPlan messages by the unit they refer to.
+// Messages without a unit reference cannot be attributed and are reported.
+func rulesToRequisites(rules Rule) (map[string][]RawRequisite, []UnrecognisedRule) {
 	unitRequisites := make(map[string][]RawRequisite)
+	unattributed := make([]UnrecognisedRule, 0)
 
 	for _, rule := range rules.CourseErrors {
+		if len(rule.References) == 0 {
+			unattributed = append(unattributed, UnrecognisedRule{
+				Title:       rule.Title,
+				Description: rule.Description,
+				Reason:      "no unit reference",
+			})
+			continue
+		}
 		unitCode := rule.References[0].UnitCode
 		if _, exists := unitRequisites[unitCode]; !exists {
 			unitRequisites[unitCode] = make([]RawRequisite, 0)
 		}
 
-		if rule.Title != "Duplicate unit" {
-			unitRequisites[unitCode] = append(unitRequisites[unitCode], RawRequisite{
-				Title:       rule.Title,
-				Description: rule.Description,
-			})
-		}
+		unitRequisites[unitCode] = append(unitRequisites[unitCode], RawRequisite{
+			Title:       rule.Title,
+			Description: rule.Description,
+		})
 	}
 
-	return unitRequisites
+	return unitRequisites, unattributed
 }
 
-func trimSpaces(units []string) []string {
-	trimmedUnits := make([]string, len(units))
-	for i, unit := range units {
-		trimmedUnits[i] = strings.TrimSpace(unit)
-	}
-	return trimmedUnits
-}
-
-func refineRequisites(requsiteResults map[string][]RawRequisite) map[string]*RefinedRequisite {
+// refineRequisites parses each unit's MonPlan messages and folds them into a RefinedRequisite.
+// Messages the grammar cannot parse are returned rather than dropped.
+func refineRequisites(requsiteResults map[string][]RawRequisite, extractor *codeExtractor) (map[string]*RefinedRequisite, []UnrecognisedRule) {
 	parsedRequisites := make(map[string]*RefinedRequisite)
-	// Internal Note: This does not cover every unit, and nil's them by default, to fix
+	unrecognised := make([]UnrecognisedRule, 0)
+
 	for unit, unitRules := range requsiteResults {
-		parsedRequisites[unit] = &RefinedRequisite{
-			Permission:    false,
-			Prohibitions:  make([]string, 0),
-			Corequisites:  make([]map[string]interface{}, 0),
-			Prerequisites: make([]map[string]interface{}, 0),
-			CPRequired:    0,
-		}
+		refined := newRefinedRequisite()
+		parsedRequisites[unit] = refined
 
 		for _, unitRule := range unitRules {
-			switch unitRule.Title {
-			case "Prohibited unit":
-				parsedRequisites[unit].Prohibitions = append(
-					parsedRequisites[unit].Prohibitions,
-					getNamedUnits(unitRule.Description)...,
-				)
-
-			case "Have not enrolled in a unit", "Have not completed enough units":
-				parsedRequisites[unit].Prerequisites = append(
-					parsedRequisites[unit].Prerequisites,
-					map[string]interface{}{
-						"NumReq": 1,
-						"units":  getNamedUnits(unitRule.Description),
-					},
-				)
-
-			case "Have not passed enough units", "Missing corequisites":
-				splits := strings.Split(unitRule.Description, ":")
-				numberRequiredMsg, unitsMsg := splits[0], splits[1]
-
-				if strings.Contains(unitRule.Title, "Have not passed enough units") {
-					parsedRequisites[unit].Prerequisites = append(
-						parsedRequisites[unit].Prerequisites,
-						map[string]interface{}{
-							"NumReq": getNumberFromMsg(numberRequiredMsg),
-							"units":  trimSpaces(strings.Split(strings.ReplaceAll(unitsMsg, " or", ","), ", ")), // Need to strip here
-						},
-					)
-				} else {
-					parsedRequisites[unit].Corequisites = append(
-						parsedRequisites[unit].Corequisites,
-						map[string]interface{}{
-							"NumReq": getNumberFromMsg(numberRequiredMsg),
-							"units":  trimSpaces(strings.Split(strings.ReplaceAll(unitsMsg, " or", ","), ", ")),
-						},
-					)
-				}
-
-			case "Not enough passed credit points", "Not enough enrolled credit points":
-				parsedRequisites[unit].CPRequired = getNumberFromMsg(unitRule.Description)
-
-			case "Permission is required for this unit":
-				parsedRequisites[unit].Permission = true
+			parsed, relevant, err := parseRule(unit, unitRule, extractor)
+			if err != nil {
+				unrecognised = append(unrecognised, UnrecognisedRule{
+					Unit:        unit,
+					Title:       unitRule.Title,
+					Description: unitRule.Description,
+					Reason:      err.Error(),
+				})
+				continue
 			}
-		}
+			if !relevant {
+				continue
+			}
+			refined.Rules = append(refined.Rules, parsed)
 
-	}
+			switch parsed.Kind {
+			case RuleProhibition:
+				refined.Prohibitions = append(refined.Prohibitions, parsed.Units...)
 
-	return parsedRequisites
-}
+			case RulePrerequisite:
+				refined.Prerequisites = append(refined.Prerequisites, map[string]interface{}{
+					"NumReq": parsed.NumRequired,
+					"units":  parsed.Units,
+				})
 
-func ProcessRequisites() map[string]*RefinedRequisite {
-	var requisite_rules []Rule
-	var prohibition_rules []Rule
+			case RuleCorequisite:
+				refined.Corequisites = append(refined.Corequisites, map[string]interface{}{
+					"NumReq": parsed.NumRequired,
+					"units":  parsed.Units,
+				})
 
-	file1, err := os.ReadFile("data/raw_prerequisites.json")
-	if err != nil {
-		log.Fatal(err)
+			case RuleCreditPoints:
+				refined.CreditPoints = append(refined.CreditPoints, parsed.CreditPoints...)
+
+			case RulePermission:
+				refined.Permission = true
+			}
+		}
+		refined.Prohibitions = codes.UniqueSorted(refined.Prohibitions)
+		if refined.Prohibitions == nil {
+			refined.Prohibitions = make([]string, 0)
+		}
 	}
-	if err := json.Unmarshal(file1, &requisite_rules); err != nil {
-		log.Fatal(err)
+
+	return parsedRequisites, unrecognised
+}
+
+// symmetriseProhibitions makes every prohibition hold in both directions, since MonPlan only
+// reports a prohibition against the units present in the probed plan.
+func symmetriseProhibitions(refined map[string]*RefinedRequisite) {
+	pairs := make(map[string][]string)
+	for unit, requisite := range refined {
+		for _, prohibited := range requisite.Prohibitions {
+			pairs[prohibited] = append(pairs[prohibited], unit)
+		}
 	}
 
-	file2, err := os.ReadFile("data/raw_prohibitions.json")
-	if err != nil {
-		log.Fatal(err)
+	for unit, prohibitedBy := range pairs {
+		requisite, ok := refined[unit]
+		if !ok {
+			requisite = newRefinedRequisite()
+			refined[unit] = requisite
+		}
+		requisite.Prohibitions = codes.UniqueSorted(append(requisite.Prohibitions, prohibitedBy...))
 	}
-	if err := json.Unmarshal(file2, &prohibition_rules); err != nil {
-		log.Fatal(err)
-	} // this appears so much...
+}
 
+// ProcessRequisites parses the MonPlan responses into refined requisites.
+// Only the "Prohibited unit" messages of the prohibition probes are used.
+// Also returns the messages the grammar could not parse and the codes named in
+// MonPlan messages that are missing from the index.
+func ProcessRequisites(requisite_rules []Rule, prohibition_rules []Rule, index *codes.Index) (map[string]*RefinedRequisite, []UnrecognisedRule, []codes.UnknownCodes) {
 	var rules = Rule{}
 
 	for _, rule := range requisite_rules {
@@ -180,37 +193,172 @@ func ProcessRequisites() map[string]*RefinedRequisite {
 
 	for _, rule := range prohibition_rules { // have to filter here
 		for _, message := range rule.CourseErrors {
-			if message.Title == "Prohibited Unit" {
+			if normaliseTitle(message.Title) == "prohibited unit" {
 				rules.CourseErrors = append(rules.CourseErrors, message)
 			}
 		}
 
 	}
 
-	rawRequisites := rulesToRequisites(rules)
-	return refineRequisites(rawRequisites)
+	rawRequisites, unattributed := rulesToRequisites(rules)
+	extractor := &codeExtractor{index: index, unknown: make([]codes.UnknownCodes, 0)}
+	refined, unrecognised := refineRequisites(rawRequisites, extractor)
+	symmetriseProhibitions(refined)
+	unrecognised = append(unattributed, unrecognised...)
+	sort.Slice(unrecognised, func(i, j int) bool {
+		if unrecognised[i].Unit != unrecognised[j].Unit {
+			return unrecognised[i].Unit < unrecognised[j].Unit
+		}
+		return unrecognised[i].Title < unrecognised[j].Title
+	})
+	codes.SortUnknown(extractor.unknown)
+	return refined, unrecognised, extractor.unknown
+
+}
 
+// RulesFromResponses decodes raw MonPlan responses, as returned by scrape.FetchRequisites.
+func RulesFromResponses(responses []map[string]interface{}) ([]Rule, error) {
+	data, err := json.Marshal(responses)
+	if err != nil {
+		return nil, fmt.Errorf("encoding MonPlan responses: %w", err)
+	}
+	rules := make([]Rule, 0, len(responses))
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("decoding MonPlan responses: %w", err)
+	}
+	return rules, nil
 }
 
-func ProcessHandbook() map[string]interface{} {
+// ProcessInput is everything the process step combines.
+type ProcessInput struct {
+	// Units are the formatted units by code, either as format.FormatUnits returns them or as
+	// decoded from JSON. Typed fields such as enrolment_rules are read in their JSON form.
+	Units map[string]interface{}
+	// Prerequisites and Prohibitions are the MonPlan responses of the requisite scrape
+	Prerequisites []Rule
+	Prohibitions  []Rule
+	// Courses and AOS are the formatted collections, if they were scraped, for used_in membership.
+	// Like Units they may come straight from the formatter or from JSON.
+	Courses map[string]interface{}
+	AOS     map[string]interface{}
+	// Index is the CourseLoop unit index; nil falls back to the formatted unit codes
+	Index *codes.Index
+}
+
+// jsonValues converts a formatted collection to the plain maps and slices JSON decodes to,
+// so records fresh from the formatter read the same as stored ones.
+func jsonValues(collection map[string]interface{}) (map[string]interface{}, error) {
+	if collection == nil {
+		return make(map[string]interface{}), nil
+	}
+	data, err := json.Marshal(collection)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
 
-	processesdRequisites := ProcessRequisites()
+// ProcessResult is the processed units and the reports produced along the way.
+type ProcessResult struct {
+	Units          map[string]interface{}
+	Unrecognised   []UnrecognisedRule
+	UnknownCodes   []codes.UnknownCodes
+	Reconciliation *ReconciliationReport
+	Analysis       *GraphAnalysis
+}
 
-	var processedHandbook map[string]interface{}
+func ProcessHandbook(input ProcessInput) (*ProcessResult, error) {
 
-	file, err := os.ReadFile("data/formatted_units.json") // Separate loading
+	if input.Units == nil {
+		return nil, errors.New("no formatted units given")
+	}
+	processedHandbook, err := jsonValues(input.Units)
+	if err != nil {
+		return nil, fmt.Errorf("reading formatted units: %w", err)
+	}
+	courses, err := jsonValues(input.Courses)
+	if err != nil {
+		return nil, fmt.Errorf("reading formatted courses: %w", err)
+	}
+	aos, err := jsonValues(input.AOS)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("reading formatted areas of study: %w", err)
 	}
 
-	if err := json.Unmarshal(file, &processedHandbook); err != nil {
-		log.Fatal(err)
+	index := input.Index
+	if index == nil {
+		unitCodes := make([]string, 0, len(processedHandbook))
+		for unitCode := range processedHandbook {
+			unitCodes = append(unitCodes, unitCode)
+		}
+		index = codes.NewIndex(unitCodes)
 	}
 
+	processesdRequisites, unrecognised, unknownCodes := ProcessRequisites(input.Prerequisites, input.Prohibitions, index)
+
 	for unitCode := range processedHandbook {
-		processedHandbook[unitCode].(map[string]interface{})["requisites"] = processesdRequisites[unitCode]
+		unit, ok := processedHandbook[unitCode].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("formatted unit %s is not an object", unitCode)
+		}
+		requisites := processesdRequisites[unitCode]
+		restrictions := ruleCourses(unit, "course_restriction")
+		exclusions := ruleCourses(unit, "course_exclusion")
+		if requisites == nil && len(restrictions)+len(exclusions) > 0 {
+			requisites = newRefinedRequisite()
+			processesdRequisites[unitCode] = requisites
+		}
+		if requisites != nil {
+			if len(exclusions) > 0 {
+				requisites.ExcludedCourses = exclusions
+			}
+			requisites.PrerequisiteTree, requisites.CorequisiteTree = BuildRequisiteTrees(requisites, restrictions)
+			requisites.PrerequisiteExpression = requisites.PrerequisiteTree.String()
+			requisites.CorequisiteExpression = requisites.CorequisiteTree.String()
+		}
+	}
+
+	reconciliation := Reconcile(processedHandbook, processesdRequisites)
+	reverseIndex := BuildReverseIndex(processesdRequisites)
+	analysis := AnalyseRequisites(processesdRequisites)
+
+	membership := BuildUnitMembership(courses, aos)
+
+	for unitCode := range processedHandbook {
+		unit := processedHandbook[unitCode].(map[string]interface{})
+		unit["requisites"] = processesdRequisites[unitCode]
+
+		usedIn, ok := membership[unitCode]
+		if !ok {
+			usedIn = &UnitMembership{AOS: make([]string, 0), Courses: make([]string, 0)}
+		}
+		unit["used_in"] = usedIn
+
+		reverse, ok := reverseIndex[unitCode]
+		if !ok {
+			reverse = newReverseRequisites()
+		}
+		unit["unlocks"] = reverse.Unlocks
+		unit["corequisite_of"] = reverse.CorequisiteOf
+		unit["prohibited_by"] = reverse.ProhibitedBy
+
+		unitAnalysis, ok := analysis.Units[unitCode]
+		if !ok {
+			unitAnalysis = &UnitAnalysis{EarliestYear: 1}
+		}
+		unit["analysis"] = unitAnalysis
 	}
 
-	return processedHandbook
+	return &ProcessResult{
+		Units:          processedHandbook,
+		Unrecognised:   unrecognised,
+		UnknownCodes:   unknownCodes,
+		Reconciliation: reconciliation,
+		Analysis:       analysis,
+	}, nil
 
 }
@@ -0,0 +1,71 @@
+package process
+
+import "strconv"
+
+// Typed view of processed_units.json for the commands that read the final output.
+
+type ProcessedUnit struct {
+	Title         string                   `json:"title"`
+	Code          string                   `json:"code"`
+	CreditPoints  interface{}              `json:"credit_points"`
+	Level         int                      `json:"level"`
+	AcademicOrg   string                   `json:"academic_org"`
+	School        string                   `json:"school"`
+	Offerings     []map[string]interface{} `json:"offerings"`
+	Requisites    *RefinedRequisite        `json:"requisites"`
+	UsedIn        *UnitMembership          `json:"used_in"`
+	Unlocks       []string                 `json:"unlocks"`
+	CorequisiteOf []string                 `json:"corequisite_of"`
+	ProhibitedBy  []string                 `json:"prohibited_by"`
+	Analysis      *UnitAnalysis            `json:"analysis"`
+}
+
+// Points returns the unit's credit points, which the handbook stores as a string.
+func (unit *ProcessedUnit) Points() int {
+	switch v := unit.CreditPoints.(type) {
+	case float64:
+		return int(v)
+	case string:
+		if points, err := strconv.Atoi(v); err == nil {
+			return points
+		}
+	}
+	return 6
+}
+
+// PrerequisiteUnits lists the units named in a unit's prerequisite tree.
+func (unit *ProcessedUnit) PrerequisiteUnits() []string {
+	if unit.Requisites == nil {
+		return nil
+	}
+	return unit.Requisites.PrerequisiteTree.Units()
+}
+
+// CorequisiteUnits lists the units named in a unit's corequisite tree.
+func (unit *ProcessedUnit) CorequisiteUnits() []string {
+	if unit.Requisites == nil {
+		return nil
+	}
+	return unit.Requisites.CorequisiteTree.Units()
+}
+
+// ProhibitedUnits lists the units that cannot be taken alongside this one.
+func (unit *ProcessedUnit) ProhibitedUnits() []string {
+	if unit.Requisites == nil {
+		return nil
+	}
+	return unit.Requisites.Prohibitions
+}
+
+// ExcludesCourse reports whether students of the course are kept out of the unit.
+func (unit *ProcessedUnit) ExcludesCourse(course string) bool {
+	if unit.Requisites == nil || course == "" {
+		return false
+	}
+	for _, excluded := range unit.Requisites.ExcludedCourses {
+		if excluded == course {
+			return true
+		}
+	}
+	return false
+}
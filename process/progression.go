@@ -0,0 +1,303 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"handbook-scraper/codes"
+	"handbook-scraper/format"
+	"sort"
+	"strings"
+)
+
+// Walks a course's curriculum structure against a student's completed units.
+// A completed unit earns its credit points once, under the first node that names it.
+
+const (
+	StatusSatisfied  = "satisfied"
+	StatusPartial    = "partial"
+	StatusNotStarted = "not_started"
+)
+
+type NodeProgress struct {
+	Title          string          `json:"title,omitempty"`
+	Kind           string          `json:"kind"`
+	Code           string          `json:"code,omitempty"`
+	Status         string          `json:"status"`
+	RequiredPoints int             `json:"required_credit_points"`
+	EarnedPoints   int             `json:"earned_credit_points"`
+	MissingPoints  int             `json:"missing_credit_points"`
+	CountedUnits   []string        `json:"counted_units,omitempty"`
+	CandidateUnits []string        `json:"candidate_units,omitempty"`
+	Children       []*NodeProgress `json:"children,omitempty"`
+}
+
+type ProgressionReport struct {
+	Course     string        `json:"course"`
+	Title      string        `json:"title"`
+	Completed  []string      `json:"completed"`
+	Uncounted  []string      `json:"uncounted"`
+	Unresolved []string      `json:"unresolved"`
+	Progress   *NodeProgress `json:"progress"`
+}
+
+// structureFromRecord recovers the typed curriculum structure from a decoded formatted record.
+func structureFromRecord(record map[string]interface{}) ([]format.StructureElement, error) {
+	var structure []format.StructureElement
+	raw, ok := record["curriculum_structure"]
+	if !ok || raw == nil {
+		return structure, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &structure); err != nil {
+		return nil, err
+	}
+	return structure, nil
+}
+
+type progressionWalker struct {
+	completed  map[string]bool
+	counted    map[string]bool
+	courses    map[string]interface{}
+	units      map[string]interface{}
+	aos        map[string]interface{}
+	unresolved []string
+	expanding  map[string]bool
+}
+
+// expand replaces an AOS or component course leaf with that item's own requirement tree.
+func (w *progressionWalker) expand(node *format.RequirementNode, collection map[string]interface{}) *format.RequirementNode {
+	record, ok := collection[node.Code].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	structure, err := structureFromRecord(record)
+	if err != nil || len(structure) == 0 {
+		return nil
+	}
+	tree := format.BuildRequirementTree(node.Code, structure)
+	w.unresolved = append(w.unresolved, format.ResolveRequirements(tree, w.units, w.aos)...)
+	tree.Code = node.Code
+	tree.MinCreditPoints = node.CreditPoints
+	return tree
+}
+
+func (w *progressionWalker) walk(node *format.RequirementNode) *NodeProgress {
+	progress := &NodeProgress{
+		Title: node.Title,
+		Kind:  string(node.Kind),
+		Code:  node.Code,
+	}
+
+	switch node.Kind {
+	case format.RequirementUnit:
+		progress.RequiredPoints = format.AttainableCreditPoints(node)
+		if w.completed[node.Code] {
+			// Listed again under another node, the unit meets it but its credit is already counted
+			if !w.counted[node.Code] {
+				w.counted[node.Code] = true
+				progress.EarnedPoints = progress.RequiredPoints
+			}
+			progress.CountedUnits = []string{node.Code}
+		} else {
+			progress.CandidateUnits = []string{node.Code}
+		}
+		return w.finish(progress, w.completed[node.Code])
+
+	case format.RequirementAOS, format.RequirementCourse:
+		collection := w.aos
+		if node.Kind == format.RequirementCourse {
+			collection = w.courses
+		}
+		if !w.expanding[node.Code] {
+			if subtree := w.expand(node, collection); subtree != nil {
+				w.expanding[node.Code] = true
+				expanded := w.walk(subtree)
+				delete(w.expanding, node.Code)
+				expanded.Kind = string(node.Kind)
+				expanded.Title = node.Name
+				return expanded
+			}
+		}
+		progress.RequiredPoints = node.CreditPoints
+		return w.finish(progress, false)
+	}
+
+	childrenRequired := make([]int, 0, len(node.Children))
+	for _, child := range node.Children {
+		childProgress := w.walk(child)
+		progress.Children = append(progress.Children, childProgress)
+		progress.EarnedPoints += childProgress.EarnedPoints
+		progress.CountedUnits = append(progress.CountedUnits, childProgress.CountedUnits...)
+		childrenRequired = append(childrenRequired, childProgress.RequiredPoints)
+	}
+
+	satisfiedChildren := 0
+	for _, child := range progress.Children {
+		if child.Status == StatusSatisfied {
+			satisfiedChildren++
+		}
+	}
+
+	// Credit points needed from children when the node itself does not state a minimum
+	required := childrenRequired
+	sort.Ints(required)
+	switch node.Kind {
+	case format.RequirementAny:
+		if len(required) > 0 {
+			progress.RequiredPoints = required[0]
+		}
+	case format.RequirementChoose:
+		for idx := 0; idx < node.Choose && idx < len(required); idx++ {
+			progress.RequiredPoints += required[idx]
+		}
+	default:
+		for _, points := range required {
+			progress.RequiredPoints += points
+		}
+	}
+	if node.MinCreditPoints > 0 {
+		progress.RequiredPoints = node.MinCreditPoints
+	}
+
+	var satisfied bool
+	switch node.Kind {
+	case format.RequirementAny:
+		satisfied = satisfiedChildren > 0 || len(progress.Children) == 0
+		if node.MinCreditPoints > 0 {
+			satisfied = progress.EarnedPoints >= node.MinCreditPoints
+		}
+	case format.RequirementChoose:
+		satisfied = satisfiedChildren >= node.Choose && progress.EarnedPoints >= node.MinCreditPoints
+	default:
+		satisfied = satisfiedChildren == len(progress.Children) && progress.EarnedPoints >= node.MinCreditPoints
+	}
+
+	if !satisfied {
+		for _, child := range progress.Children {
+			if child.Status != StatusSatisfied {
+				progress.CandidateUnits = append(progress.CandidateUnits, child.CandidateUnits...)
+			}
+		}
+	}
+	progress.CandidateUnits = codes.UniqueSorted(progress.CandidateUnits)
+	progress.CountedUnits = codes.UniqueSorted(progress.CountedUnits)
+
+	return w.finish(progress, satisfied)
+}
+
+func (w *progressionWalker) finish(progress *NodeProgress, satisfied bool) *NodeProgress {
+	switch {
+	case satisfied:
+		progress.Status = StatusSatisfied
+		progress.CandidateUnits = nil
+	case progress.EarnedPoints > 0:
+		progress.Status = StatusPartial
+	default:
+		progress.Status = StatusNotStarted
+	}
+	if !satisfied && progress.RequiredPoints > progress.EarnedPoints {
+		progress.MissingPoints = progress.RequiredPoints - progress.EarnedPoints
+	}
+	return progress
+}
+
+// CheckProgression evaluates a course's curriculum structure against completed units.
+// Courses, units and AOS are the formatted collections produced by the format step.
+func CheckProgression(courseCode string, completedUnits []string, courses map[string]interface{}, units map[string]interface{}, aos map[string]interface{}) (*ProgressionReport, error) {
+	course, ok := courses[courseCode].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unknown course %s", courseCode)
+	}
+
+	structure, err := structureFromRecord(course)
+	if err != nil {
+		return nil, fmt.Errorf("reading curriculum structure for %s: %w", courseCode, err)
+	}
+	if len(structure) == 0 {
+		return nil, fmt.Errorf("course %s has no curriculum structure", courseCode)
+	}
+
+	title, _ := course["title"].(string)
+	tree := format.BuildRequirementTree(title, structure)
+	tree.MinCreditPoints = codes.ParseInt(course["credit_points"])
+
+	walker := &progressionWalker{
+		completed: make(map[string]bool),
+		counted:   make(map[string]bool),
+		courses:   courses,
+		units:     units,
+		aos:       aos,
+		expanding: map[string]bool{courseCode: true},
+	}
+	walker.unresolved = format.ResolveRequirements(tree, units, aos)
+
+	for _, unit := range completedUnits {
+		walker.completed[codes.Normalise(unit)] = true
+	}
+
+	report := &ProgressionReport{
+		Course:    courseCode,
+		Title:     title,
+		Completed: codes.Sorted(walker.completed),
+		Progress:  walker.walk(tree),
+	}
+
+	for unit := range walker.completed {
+		if !walker.counted[unit] {
+			report.Uncounted = append(report.Uncounted, unit)
+		}
+	}
+	report.Uncounted = codes.UniqueSorted(report.Uncounted)
+	report.Unresolved = codes.UniqueSorted(walker.unresolved)
+
+	return report, nil
+}
+
+// FormatProgression renders a progression report as an indented plain text tree.
+func FormatProgression(report *ProgressionReport) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%s %s\n", report.Course, report.Title)
+	writeNodeProgress(&builder, report.Progress, 0)
+	if len(report.Uncounted) > 0 {
+		fmt.Fprintf(&builder, "Completed units not counted toward the course: %s\n", strings.Join(report.Uncounted, ", "))
+	}
+	return builder.String()
+}
+
+func writeNodeProgress(builder *strings.Builder, node *NodeProgress, depth int) {
+	label := node.Title
+	if node.Code != "" && node.Code != node.Title {
+		label = strings.TrimSpace(node.Code + " " + node.Title)
+	}
+	fmt.Fprintf(builder, "%s[%s] %s (%d/%d cp)", strings.Repeat("  ", depth), node.Status, label, node.EarnedPoints, node.RequiredPoints)
+	if node.MissingPoints > 0 {
+		fmt.Fprintf(builder, ", %d cp missing", node.MissingPoints)
+	}
+	builder.WriteString("\n")
+
+	if node.Status == StatusSatisfied || len(node.Children) == 0 {
+		return
+	}
+	for _, child := range node.Children {
+		if child.Kind == string(format.RequirementUnit) {
+			continue
+		}
+		writeNodeProgress(builder, child, depth+1)
+	}
+	if leaves := openUnitLeaves(node); len(leaves) > 0 {
+		fmt.Fprintf(builder, "%s  options: %s\n", strings.Repeat("  ", depth), strings.Join(leaves, ", "))
+	}
+}
+
+func openUnitLeaves(node *NodeProgress) []string {
+	leaves := make([]string, 0)
+	for _, child := range node.Children {
+		if child.Kind == string(format.RequirementUnit) && child.Status != StatusSatisfied {
+			leaves = append(leaves, child.Code)
+		}
+	}
+	return leaves
+}
@@ -0,0 +1,74 @@
+package process
+
+import (
+	"encoding/json"
+	"testing"
+
+	"handbook-scraper/format"
+)
+
+// decoded round trips a value through JSON, giving the shape records have when read from the store.
+func decoded(t *testing.T, value interface{}) interface{} {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestCheckProgression(t *testing.T) {
+	// FIT1008 is both a core unit and one of the electives
+	structure := []format.StructureElement{
+		{Title: "Core units", CreditPoints: 12, Courses: map[string]string{"FIT1045": "", "FIT1008": ""}},
+		{Title: "Electives", CreditPoints: 12, Courses: map[string]string{"FIT1008": "", "FIT2004": "", "FIT2099": ""}},
+	}
+	courses := map[string]interface{}{
+		"C2001": decoded(t, map[string]interface{}{"title": "Bachelor of Computer Science", "credit_points": 24, "curriculum_structure": structure}),
+	}
+	units := make(map[string]interface{})
+	for _, code := range []string{"FIT1045", "FIT1008", "FIT2004", "FIT2099", "ATS1001"} {
+		units[code] = map[string]interface{}{"code": code, "credit_points": "6"}
+	}
+
+	tests := []struct {
+		name      string
+		completed []string
+		earned    int
+		status    string
+		uncounted int
+	}{
+		{"nothing completed", nil, 0, StatusNotStarted, 0},
+		{"one core and one elective", []string{"FIT1045", "FIT2004"}, 12, StatusPartial, 0},
+		{"overlapping unit counted once", []string{"FIT1045", "FIT1008"}, 12, StatusPartial, 0},
+		{"overlapping unit and both other electives", []string{"FIT1045", "FIT1008", "FIT2004", "FIT2099"}, 24, StatusSatisfied, 0},
+		{"unit outside the course", []string{"FIT1045", "ATS1001"}, 6, StatusPartial, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report, err := CheckProgression("C2001", test.completed, courses, units, map[string]interface{}{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			progress := report.Progress
+			if progress.EarnedPoints != test.earned || progress.Status != test.status {
+				t.Errorf("earned %d (%s), want %d (%s)", progress.EarnedPoints, progress.Status, test.earned, test.status)
+			}
+			if progress.RequiredPoints != 24 || progress.MissingPoints != 24-test.earned {
+				t.Errorf("required %d, missing %d, want 24 and %d", progress.RequiredPoints, progress.MissingPoints, 24-test.earned)
+			}
+			if len(report.Uncounted) != test.uncounted {
+				t.Errorf("uncounted %v, want %d units", report.Uncounted, test.uncounted)
+			}
+		})
+	}
+
+	if _, err := CheckProgression("C9999", nil, courses, units, nil); err == nil {
+		t.Error("want an error for an unknown course")
+	}
+}
@@ -0,0 +1,198 @@
+package process
+
+import (
+	"handbook-scraper/codes"
+	"strings"
+)
+
+// Compares the handbook's own requisites with the requisites derived from MonPlan courseErrors.
+// Each disagreement is flagged with a severity so it can be raised with the university:
+//   high   - MonPlan does not enforce a rule the handbook states, so students can enrol against it
+//   medium - MonPlan enforces a rule the handbook does not state, or the two name different units
+//   low    - the disagreement is only in direction, e.g. a prohibition recorded on the other unit
+
+const (
+	SeverityHigh   = "high"
+	SeverityMedium = "medium"
+	SeverityLow    = "low"
+
+	FlagProhibitionHandbookOnly = "prohibition_handbook_only"
+	FlagProhibitionMonPlanOnly  = "prohibition_monplan_only"
+	FlagPrerequisitesDiffer     = "prerequisites_differ"
+	FlagCorequisitesDiffer      = "corequisites_differ"
+	FlagNoMonPlanErrors         = "handbook_rules_without_monplan_errors"
+)
+
+type ReconciliationFlag struct {
+	Unit         string   `json:"unit"`
+	Kind         string   `json:"kind"`
+	Severity     string   `json:"severity"`
+	Message      string   `json:"message"`
+	HandbookOnly []string `json:"handbook_only,omitempty"`
+	MonPlanOnly  []string `json:"monplan_only,omitempty"`
+}
+
+type ReconciliationReport struct {
+	UnitsCompared int                  `json:"units_compared"`
+	UnitsSkipped  []string             `json:"units_without_handbook_requisites"`
+	BySeverity    map[string]int       `json:"by_severity"`
+	ByKind        map[string]int       `json:"by_kind"`
+	Flags         []ReconciliationFlag `json:"flags"`
+}
+
+// stringList reads a decoded JSON array of strings.
+func stringList(value interface{}) []string {
+	items := make([]string, 0)
+	list, _ := value.([]interface{})
+	for _, item := range list {
+		if text, ok := item.(string); ok {
+			items = append(items, text)
+		}
+	}
+	return items
+}
+
+// setDifference returns the items of a that are not in b, sorted.
+func setDifference(a []string, b []string) []string {
+	inB := make(map[string]bool)
+	for _, item := range b {
+		inB[item] = true
+	}
+	difference := make([]string, 0)
+	for _, item := range codes.UniqueSorted(a) {
+		if !inB[item] {
+			difference = append(difference, item)
+		}
+	}
+	return difference
+}
+
+// hasHandbookRules reports whether the handbook states any rule MonPlan would be expected to enforce.
+// Course restrictions and exclusions are left out since the MonPlan probe is sent without course information.
+func hasHandbookRules(unit map[string]interface{}) bool {
+	if handbook, ok := unit["handbook_requisites"].(map[string]interface{}); ok {
+		for _, box := range []string{"prerequisites", "corequisites", "prohibitions"} {
+			if len(stringList(handbook[box])) > 0 {
+				return true
+			}
+		}
+	}
+	rules, _ := unit["enrolment_rules"].([]interface{})
+	for _, rule := range rules {
+		ruleMap, _ := rule.(map[string]interface{})
+		if kind, _ := ruleMap["kind"].(string); kind != "course_restriction" && kind != "course_exclusion" && kind != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// compareSets flags units named by only one source for a requisite kind.
+func compareSets(unit string, kind string, handbook []string, monplan []string) *ReconciliationFlag {
+	handbookOnly := setDifference(handbook, monplan)
+	monplanOnly := setDifference(monplan, handbook)
+	if len(handbookOnly) == 0 && len(monplanOnly) == 0 {
+		return nil
+	}
+
+	label := strings.TrimSuffix(strings.TrimSuffix(kind, "_differ"), "s")
+	flag := &ReconciliationFlag{Unit: unit, Kind: kind, HandbookOnly: handbookOnly, MonPlanOnly: monplanOnly}
+	switch {
+	case len(monplan) == 0:
+		flag.Severity = SeverityHigh
+		flag.Message = "handbook lists " + label + "s that MonPlan does not enforce"
+	case len(handbook) == 0:
+		flag.Severity = SeverityMedium
+		flag.Message = "MonPlan enforces " + label + "s the handbook does not list"
+	default:
+		flag.Severity = SeverityMedium
+		flag.Message = "handbook and MonPlan name different " + label + " units"
+	}
+	return flag
+}
+
+// Reconcile compares every formatted unit's handbook requisites with its MonPlan requisites.
+func Reconcile(formatted map[string]interface{}, requisites map[string]*RefinedRequisite) *ReconciliationReport {
+	report := &ReconciliationReport{
+		BySeverity:   make(map[string]int),
+		ByKind:       make(map[string]int),
+		Flags:        make([]ReconciliationFlag, 0),
+		UnitsSkipped: make([]string, 0),
+	}
+
+	// MonPlan prohibitions in either direction, to tell a missing rule from a one sided one
+	monplanProhibited := make(map[string]map[string]bool)
+	for unit, requisite := range requisites {
+		if requisite == nil {
+			continue
+		}
+		for _, prohibited := range requisite.Prohibitions {
+			for _, pair := range [][2]string{{unit, prohibited}, {prohibited, unit}} {
+				if monplanProhibited[pair[0]] == nil {
+					monplanProhibited[pair[0]] = make(map[string]bool)
+				}
+				monplanProhibited[pair[0]][pair[1]] = true
+			}
+		}
+	}
+
+	add := func(flag *ReconciliationFlag) {
+		if flag == nil {
+			return
+		}
+		report.Flags = append(report.Flags, *flag)
+		report.BySeverity[flag.Severity]++
+		report.ByKind[flag.Kind]++
+	}
+
+	for _, code := range codes.SortedKeys(formatted) {
+		unit, ok := formatted[code].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// Units formatted before handbook requisites were kept cannot be compared
+		handbook, ok := unit["handbook_requisites"].(map[string]interface{})
+		if !ok {
+			report.UnitsSkipped = append(report.UnitsSkipped, code)
+			continue
+		}
+		report.UnitsCompared++
+
+		requisite := requisites[code]
+		hasMonPlan := requisite != nil && (len(requisite.Rules) > 0 || requisite.Permission || len(requisite.Prohibitions) > 0)
+
+		if !hasMonPlan {
+			if hasHandbookRules(unit) {
+				add(&ReconciliationFlag{Unit: code, Kind: FlagNoMonPlanErrors, Severity: SeverityHigh, Message: "handbook has requisite rules but MonPlan returned no errors"})
+			}
+			continue
+		}
+
+		// Prohibitions: one sided ones are only low severity if MonPlan has the pair the other way round
+		handbookProhibitions := stringList(handbook["prohibitions"])
+		for _, prohibited := range setDifference(handbookProhibitions, requisite.Prohibitions) {
+			severity := SeverityHigh
+			if monplanProhibited[code][prohibited] {
+				severity = SeverityLow
+			}
+			add(&ReconciliationFlag{Unit: code, Kind: FlagProhibitionHandbookOnly, Severity: severity, Message: "prohibition of " + prohibited + " is only in the handbook", HandbookOnly: []string{prohibited}})
+		}
+		for _, prohibited := range setDifference(requisite.Prohibitions, handbookProhibitions) {
+			severity := SeverityMedium
+			if handbookRecord, ok := formatted[prohibited].(map[string]interface{}); ok {
+				otherHandbook, _ := handbookRecord["handbook_requisites"].(map[string]interface{})
+				for _, other := range stringList(otherHandbook["prohibitions"]) {
+					if other == code {
+						severity = SeverityLow
+					}
+				}
+			}
+			add(&ReconciliationFlag{Unit: code, Kind: FlagProhibitionMonPlanOnly, Severity: severity, Message: "prohibition of " + prohibited + " is only in MonPlan", MonPlanOnly: []string{prohibited}})
+		}
+
+		add(compareSets(code, FlagPrerequisitesDiffer, stringList(handbook["prerequisites"]), requisite.PrerequisiteTree.Units()))
+		add(compareSets(code, FlagCorequisitesDiffer, stringList(handbook["corequisites"]), requisite.CorequisiteTree.Units()))
+	}
+
+	return report
+}
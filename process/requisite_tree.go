@@ -0,0 +1,367 @@
+package process
+
+import (
+	"fmt"
+	"handbook-scraper/codes"
+	"sort"
+	"strings"
+)
+
+// A typed boolean expression over requisites.
+// Leaves are units, credit point thresholds (optionally at a unit level) and course enrolments.
+
+const (
+	OpAnd          = "and"
+	OpOr           = "or"
+	OpNOf          = "n_of"
+	OpUnit         = "unit"
+	OpCreditPoints = "credit_points"
+	OpCourse       = "course"
+)
+
+type RequisiteNode struct {
+	Op           string           `json:"op"`
+	N            int              `json:"n,omitempty"`
+	Unit         string           `json:"unit,omitempty"`
+	CreditPoints int              `json:"credit_points,omitempty"`
+	Enrolled     bool             `json:"enrolled,omitempty"`
+	Level        int              `json:"level,omitempty"`
+	LevelOrAbove bool             `json:"level_or_above,omitempty"`
+	Discipline   string           `json:"discipline,omitempty"`
+	Course       string           `json:"course,omitempty"`
+	Children     []*RequisiteNode `json:"children,omitempty"`
+}
+
+// EvalContext is what a requisite expression is evaluated against.
+// Only Completed is required; unit credit points default to 6 and course leaves fail without a course.
+// Enrolled units count toward enrolled credit point requirements only.
+type EvalContext struct {
+	Completed        map[string]bool
+	Enrolled         map[string]bool
+	UnitCreditPoints map[string]int
+	CreditPoints     int
+	Course           string
+}
+
+func UnitNode(unit string) *RequisiteNode {
+	return &RequisiteNode{Op: OpUnit, Unit: unit}
+}
+
+func CreditPointNode(constraint CreditPointConstraint) *RequisiteNode {
+	return &RequisiteNode{
+		Op:           OpCreditPoints,
+		CreditPoints: constraint.Amount,
+		Enrolled:     constraint.Kind == CreditPointsEnrolled,
+		Level:        constraint.Level,
+		LevelOrAbove: constraint.LevelOrAbove,
+		Discipline:   constraint.Discipline,
+	}
+}
+
+func CourseNode(course string) *RequisiteNode {
+	return &RequisiteNode{Op: OpCourse, Course: course}
+}
+
+func AndNode(children ...*RequisiteNode) *RequisiteNode {
+	return canonical(&RequisiteNode{Op: OpAnd, Children: children})
+}
+
+func OrNode(children ...*RequisiteNode) *RequisiteNode {
+	return canonical(&RequisiteNode{Op: OpOr, Children: children})
+}
+
+// NOfNode requires n of the children, collapsing to OR or AND at the edges.
+func NOfNode(n int, children ...*RequisiteNode) *RequisiteNode {
+	switch {
+	case n <= 1:
+		return OrNode(children...)
+	case n >= len(children):
+		return AndNode(children...)
+	}
+	return canonical(&RequisiteNode{Op: OpNOf, N: n, Children: children})
+}
+
+// canonical flattens nested AND/OR nodes of the same kind, drops nil and duplicate
+// children, orders children by their string form and unwraps single child nodes.
+func canonical(node *RequisiteNode) *RequisiteNode {
+	children := make([]*RequisiteNode, 0, len(node.Children))
+	seen := make(map[string]bool)
+
+	for _, child := range node.Children {
+		if child == nil {
+			continue
+		}
+		grandchildren := []*RequisiteNode{child}
+		if node.Op != OpNOf && child.Op == node.Op {
+			grandchildren = child.Children
+		}
+		for _, grandchild := range grandchildren {
+			key := grandchild.String()
+			if !seen[key] {
+				seen[key] = true
+				children = append(children, grandchild)
+			}
+		}
+	}
+
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].String() < children[j].String()
+	})
+
+	switch {
+	case len(children) == 0:
+		return nil
+	case len(children) == 1 && node.Op != OpNOf:
+		return children[0]
+	case node.Op == OpNOf && node.N >= len(children):
+		return canonical(&RequisiteNode{Op: OpAnd, Children: children})
+	}
+
+	node.Children = children
+	return node
+}
+
+// String renders the canonical text form, e.g. "(FIT1008 OR FIT1054) AND MAT1830".
+func (node *RequisiteNode) String() string {
+	if node == nil {
+		return ""
+	}
+
+	switch node.Op {
+	case OpUnit:
+		return node.Unit
+	case OpCourse:
+		return "ENROLLED IN " + node.Course
+	case OpCreditPoints:
+		text := fmt.Sprintf("%d CP", node.CreditPoints)
+		if node.Enrolled {
+			text = fmt.Sprintf("%d ENROLLED CP", node.CreditPoints)
+		}
+		if node.Level > 0 {
+			text += fmt.Sprintf(" AT LEVEL %d", node.Level)
+			if node.LevelOrAbove {
+				text += "+"
+			}
+		}
+		if node.Discipline != "" {
+			text += " IN " + node.Discipline
+		}
+		return text
+	}
+
+	parts := make([]string, len(node.Children))
+	for idx, child := range node.Children {
+		parts[idx] = child.String()
+		if len(child.Children) > 0 {
+			parts[idx] = "(" + parts[idx] + ")"
+		}
+	}
+
+	switch node.Op {
+	case OpAnd:
+		return strings.Join(parts, " AND ")
+	case OpOr:
+		return strings.Join(parts, " OR ")
+	case OpNOf:
+		return fmt.Sprintf("%d OF (%s)", node.N, strings.Join(parts, ", "))
+	}
+	return ""
+}
+
+func (context *EvalContext) unitCreditPoints(unit string) int {
+	if points, ok := context.UnitCreditPoints[unit]; ok {
+		return points
+	}
+	return 6
+}
+
+// creditPoints totals the credit points a credit point node counts, honouring its
+// passed/enrolled kind and its level and discipline qualifiers.
+func (context *EvalContext) creditPoints(node *RequisiteNode) int {
+	unqualified := node.Level == 0 && node.Discipline == ""
+	total := 0
+	if unqualified && context.CreditPoints > 0 {
+		total = context.CreditPoints
+	} else {
+		for unit, done := range context.Completed {
+			if done && creditPointUnitMatches(node, unit) {
+				total += context.unitCreditPoints(unit)
+			}
+		}
+	}
+	if node.Enrolled {
+		for unit, enrolled := range context.Enrolled {
+			if enrolled && !context.Completed[unit] && creditPointUnitMatches(node, unit) {
+				total += context.unitCreditPoints(unit)
+			}
+		}
+	}
+	return total
+}
+
+func creditPointUnitMatches(node *RequisiteNode, unit string) bool {
+	parsed, err := codes.Parse(unit)
+	if err != nil {
+		return node.Level == 0 && node.Discipline == ""
+	}
+	if node.Discipline != "" && parsed.Prefix != node.Discipline {
+		return false
+	}
+	switch {
+	case node.Level == 0:
+		return true
+	case node.LevelOrAbove:
+		return parsed.Level >= node.Level
+	default:
+		return parsed.Level == node.Level
+	}
+}
+
+// Evaluate checks the expression against a set of completed units.
+func (node *RequisiteNode) Evaluate(completed map[string]bool) bool {
+	return node.EvaluateWith(&EvalContext{Completed: completed})
+}
+
+// EvaluateWith checks the expression against a full evaluation context. A nil node is satisfied.
+func (node *RequisiteNode) EvaluateWith(context *EvalContext) bool {
+	if node == nil {
+		return true
+	}
+
+	switch node.Op {
+	case OpUnit:
+		return context.Completed[node.Unit]
+	case OpCourse:
+		return context.Course == node.Course
+	case OpCreditPoints:
+		return context.creditPoints(node) >= node.CreditPoints
+	}
+
+	satisfied := 0
+	for _, child := range node.Children {
+		if child.EvaluateWith(context) {
+			satisfied++
+		}
+	}
+
+	switch node.Op {
+	case OpAnd:
+		return satisfied == len(node.Children)
+	case OpOr:
+		return satisfied > 0
+	case OpNOf:
+		return satisfied >= node.N
+	}
+	return false
+}
+
+// Unmet returns the part of the expression the context does not satisfy, or nil if it is met.
+// Satisfied AND children are dropped and N-of nodes only ask for the remaining count,
+// so "2 OF (A, B, C)" with A completed becomes "1 OF (B, C)", rendered as "B OR C".
+func (node *RequisiteNode) Unmet(context *EvalContext) *RequisiteNode {
+	if node.EvaluateWith(context) {
+		return nil
+	}
+
+	switch node.Op {
+	case OpUnit, OpCourse, OpCreditPoints:
+		return node
+	}
+
+	satisfied := 0
+	unmet := make([]*RequisiteNode, 0, len(node.Children))
+	for _, child := range node.Children {
+		if remaining := child.Unmet(context); remaining != nil {
+			unmet = append(unmet, remaining)
+		} else {
+			satisfied++
+		}
+	}
+
+	switch node.Op {
+	case OpAnd:
+		return AndNode(unmet...)
+	case OpOr:
+		return OrNode(unmet...)
+	case OpNOf:
+		return NOfNode(node.N-satisfied, unmet...)
+	}
+	return node
+}
+
+// Units lists every unit named anywhere in the expression.
+func (node *RequisiteNode) Units() []string {
+	if node == nil {
+		return nil
+	}
+	if node.Op == OpUnit {
+		return []string{node.Unit}
+	}
+	units := make([]string, 0)
+	for _, child := range node.Children {
+		units = append(units, child.Units()...)
+	}
+	return codes.UniqueSorted(units)
+}
+
+// groupsToTree ANDs together MonPlan "N of these units" groups.
+func groupsToTree(groups []map[string]interface{}) *RequisiteNode {
+	nodes := make([]*RequisiteNode, 0, len(groups))
+	for _, group := range groups {
+		units, _ := group["units"].([]string)
+		numReq, _ := group["NumReq"].(int)
+
+		leaves := make([]*RequisiteNode, 0, len(units))
+		for _, unit := range units {
+			leaves = append(leaves, UnitNode(unit))
+		}
+		nodes = append(nodes, NOfNode(numReq, leaves...))
+	}
+	return AndNode(nodes...)
+}
+
+// BuildRequisiteTrees turns the refined MonPlan requisites of a unit, and any course
+// restrictions mined from its handbook enrolment rules, into prerequisite and corequisite trees.
+func BuildRequisiteTrees(refined *RefinedRequisite, courseRestrictions []string) (*RequisiteNode, *RequisiteNode) {
+	prerequisites := make([]*RequisiteNode, 0)
+
+	if refined != nil {
+		prerequisites = append(prerequisites, groupsToTree(refined.Prerequisites))
+		for _, constraint := range refined.CreditPoints {
+			prerequisites = append(prerequisites, CreditPointNode(constraint))
+		}
+	}
+
+	courses := make([]*RequisiteNode, 0, len(courseRestrictions))
+	for _, course := range courseRestrictions {
+		courses = append(courses, CourseNode(course))
+	}
+	prerequisites = append(prerequisites, OrNode(courses...))
+
+	var corequisites *RequisiteNode
+	if refined != nil {
+		corequisites = groupsToTree(refined.Corequisites)
+	}
+
+	return AndNode(prerequisites...), corequisites
+}
+
+// ruleCourses reads the course codes from a formatted unit's classified enrolment rules of one kind,
+// "course_restriction" for the courses a unit is limited to or "course_exclusion" for those kept out.
+func ruleCourses(unit map[string]interface{}, kind string) []string {
+	courses := make([]string, 0)
+	rules, _ := unit["enrolment_rules"].([]interface{})
+	for _, rule := range rules {
+		ruleMap, ok := rule.(map[string]interface{})
+		if !ok || ruleMap["kind"] != kind {
+			continue
+		}
+		ruleCourses, _ := ruleMap["courses"].([]interface{})
+		for _, course := range ruleCourses {
+			if code, ok := course.(string); ok {
+				courses = append(courses, code)
+			}
+		}
+	}
+	return codes.UniqueSorted(courses)
+}
@@ -0,0 +1,123 @@
+package process
+
+import "testing"
+
+// fit2004 is "(FIT1008 OR FIT1054) AND MAT1830" as MonPlan reports it: two unrelated groups.
+func fit2004() *RequisiteNode {
+	tree, _ := BuildRequisiteTrees(&RefinedRequisite{
+		Prerequisites: []map[string]interface{}{
+			{"NumReq": 1, "units": []string{"FIT1008", "FIT1054"}},
+			{"NumReq": 1, "units": []string{"MAT1830"}},
+		},
+	}, nil)
+	return tree
+}
+
+func completed(units ...string) map[string]bool {
+	set := make(map[string]bool)
+	for _, unit := range units {
+		set[unit] = true
+	}
+	return set
+}
+
+func TestRequisiteTreeString(t *testing.T) {
+	tests := []struct {
+		name string
+		tree *RequisiteNode
+		want string
+	}{
+		{"groups joined by AND", fit2004(), "(FIT1008 OR FIT1054) AND MAT1830"},
+		{"children sorted", AndNode(UnitNode("MAT1830"), OrNode(UnitNode("FIT1054"), UnitNode("FIT1008"))), "(FIT1008 OR FIT1054) AND MAT1830"},
+		{"nested ANDs flattened", AndNode(UnitNode("A"), AndNode(UnitNode("B"), UnitNode("C"))), "A AND B AND C"},
+		{"duplicates dropped", OrNode(UnitNode("A"), UnitNode("A")), "A"},
+		{"n of", NOfNode(2, UnitNode("A"), UnitNode("B"), UnitNode("C")), "2 OF (A, B, C)"},
+		{"n of every child", NOfNode(2, UnitNode("A"), UnitNode("B")), "A AND B"},
+		{"credit points at a level", CreditPointNode(CreditPointConstraint{Kind: CreditPointsPassed, Amount: 12, Level: 2}), "12 CP AT LEVEL 2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.tree.String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name      string
+		completed map[string]bool
+		want      bool
+	}{
+		{"nothing completed", completed(), false},
+		{"one alternative and MAT1830", completed("FIT1008", "MAT1830"), true},
+		{"other alternative and MAT1830", completed("FIT1054", "MAT1830"), true},
+		{"alternatives without MAT1830", completed("FIT1008", "FIT1054"), false},
+		{"MAT1830 alone", completed("MAT1830"), false},
+	}
+
+	tree := fit2004()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := tree.Evaluate(test.completed); got != test.want {
+				t.Errorf("Evaluate(%v) = %v, want %v", test.completed, got, test.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateCreditPoints(t *testing.T) {
+	// "48 credit points including 12 at level 2"
+	constraints := ParseCreditPointConstraints("Not enough passed credit points", "You need at least 48 credit points including 12 at level 2")
+	tree, _ := BuildRequisiteTrees(&RefinedRequisite{CreditPoints: constraints}, nil)
+
+	tests := []struct {
+		name    string
+		context *EvalContext
+		want    bool
+	}{
+		{"eight level 1 units", &EvalContext{Completed: completed("FIT1008", "FIT1045", "FIT1047", "FIT1049", "MAT1830", "MAT1841", "ENG1005", "ENG1090")}, false},
+		{"six level 1 and two level 2 units", &EvalContext{Completed: completed("FIT1008", "FIT1045", "FIT1047", "FIT1049", "MAT1830", "MAT1841", "FIT2004", "FIT2014")}, true},
+		{"two level 2 units only", &EvalContext{Completed: completed("FIT2004", "FIT2014")}, false},
+		{"stated total with two level 2 units", &EvalContext{Completed: completed("FIT2004", "FIT2014"), CreditPoints: 48}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := tree.EvaluateWith(test.context); got != test.want {
+				t.Errorf("EvaluateWith = %v, want %v (tree %s)", got, test.want, tree)
+			}
+		})
+	}
+}
+
+func TestUnmet(t *testing.T) {
+	tests := []struct {
+		name      string
+		tree      *RequisiteNode
+		completed map[string]bool
+		want      string
+	}{
+		{"nothing completed", fit2004(), completed(), "(FIT1008 OR FIT1054) AND MAT1830"},
+		{"met AND child dropped", fit2004(), completed("MAT1830"), "FIT1008 OR FIT1054"},
+		{"met OR child dropped", fit2004(), completed("FIT1054"), "MAT1830"},
+		{"all met", fit2004(), completed("FIT1008", "MAT1830"), ""},
+		{"n of asks for the rest", NOfNode(2, UnitNode("A"), UnitNode("B"), UnitNode("C")), completed("A"), "B OR C"},
+		{"course leaf", AndNode(UnitNode("A"), CourseNode("C2001")), completed("A"), "ENROLLED IN C2001"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			unmet := test.tree.Unmet(&EvalContext{Completed: test.completed})
+			got := ""
+			if unmet != nil {
+				got = unmet.String()
+			}
+			if got != test.want {
+				t.Errorf("Unmet = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
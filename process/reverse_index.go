@@ -0,0 +1,122 @@
+package process
+
+import (
+	"handbook-scraper/codes"
+	"sort"
+)
+
+// Reverse requisite edges: for each unit, the units it helps unlock.
+
+type ReverseRequisites struct {
+	Unlocks       []string `json:"unlocks"`
+	CorequisiteOf []string `json:"corequisite_of"`
+	ProhibitedBy  []string `json:"prohibited_by"`
+}
+
+func newReverseRequisites() *ReverseRequisites {
+	return &ReverseRequisites{
+		Unlocks:       make([]string, 0),
+		CorequisiteOf: make([]string, 0),
+		ProhibitedBy:  make([]string, 0),
+	}
+}
+
+// BuildReverseIndex inverts the prerequisite, corequisite and prohibition edges of every unit.
+func BuildReverseIndex(requisites map[string]*RefinedRequisite) map[string]*ReverseRequisites {
+	index := make(map[string]*ReverseRequisites)
+	entry := func(unit string) *ReverseRequisites {
+		if _, exists := index[unit]; !exists {
+			index[unit] = newReverseRequisites()
+		}
+		return index[unit]
+	}
+
+	for unit, requisite := range requisites {
+		if requisite == nil {
+			continue
+		}
+		for _, prerequisite := range requisite.PrerequisiteTree.Units() {
+			entry(prerequisite).Unlocks = append(entry(prerequisite).Unlocks, unit)
+		}
+		for _, corequisite := range requisite.CorequisiteTree.Units() {
+			entry(corequisite).CorequisiteOf = append(entry(corequisite).CorequisiteOf, unit)
+		}
+		for _, prohibited := range requisite.Prohibitions {
+			entry(prohibited).ProhibitedBy = append(entry(prohibited).ProhibitedBy, unit)
+		}
+	}
+
+	for _, reverse := range index {
+		sort.Strings(reverse.Unlocks)
+		sort.Strings(reverse.CorequisiteOf)
+		reverse.ProhibitedBy = codes.UniqueSorted(reverse.ProhibitedBy)
+		if reverse.ProhibitedBy == nil {
+			reverse.ProhibitedBy = make([]string, 0)
+		}
+	}
+	return index
+}
+
+type UnlockReport struct {
+	Completed  []string `json:"completed"`
+	Direct     []string `json:"direct"`
+	Transitive []string `json:"transitive"`
+}
+
+// Unlocked finds the units whose prerequisites are met by the completed units (direct),
+// and those that become available once the direct units are passed in turn (transitive).
+// Only units whose prerequisites are unmet with nothing completed are considered. Every one
+// still pending is checked again after each round, so units gated by credit points count too.
+func Unlocked(units map[string]*ProcessedUnit, completedUnits []string, course string) *UnlockReport {
+	context := &EvalContext{
+		Completed:        make(map[string]bool),
+		UnitCreditPoints: make(map[string]int),
+		Course:           course,
+	}
+	for code, unit := range units {
+		context.UnitCreditPoints[code] = unit.Points()
+	}
+
+	pending := make(map[string]bool)
+	for code, unit := range units {
+		if unit.Requisites != nil && !unit.Requisites.PrerequisiteTree.EvaluateWith(context) {
+			pending[code] = true
+		}
+	}
+	for _, unit := range completedUnits {
+		context.Completed[unit] = true
+		delete(pending, unit)
+	}
+
+	report := &UnlockReport{
+		Completed:  codes.UniqueSorted(completedUnits),
+		Direct:     make([]string, 0),
+		Transitive: make([]string, 0),
+	}
+
+	for round := 0; ; round++ {
+		newlyUnlocked := make([]string, 0)
+		for candidate := range pending {
+			if units[candidate].Requisites.PrerequisiteTree.EvaluateWith(context) {
+				newlyUnlocked = append(newlyUnlocked, candidate)
+			}
+		}
+		if len(newlyUnlocked) == 0 {
+			break
+		}
+		sort.Strings(newlyUnlocked)
+
+		for _, unit := range newlyUnlocked {
+			context.Completed[unit] = true
+			delete(pending, unit)
+		}
+		if round == 0 {
+			report.Direct = append(report.Direct, newlyUnlocked...)
+		} else {
+			report.Transitive = append(report.Transitive, newlyUnlocked...)
+		}
+	}
+
+	sort.Strings(report.Transitive)
+	return report
+}
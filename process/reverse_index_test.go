@@ -0,0 +1,50 @@
+package process
+
+import (
+	"reflect"
+	"testing"
+)
+
+// requisiteUnit is a processed unit whose prerequisites are the given tree.
+func requisiteUnit(code string, tree *RequisiteNode) *ProcessedUnit {
+	requisites := newRefinedRequisite()
+	requisites.PrerequisiteTree = tree
+	return &ProcessedUnit{Code: code, Requisites: requisites}
+}
+
+func TestUnlocked(t *testing.T) {
+	units := map[string]*ProcessedUnit{
+		"FIT1045": requisiteUnit("FIT1045", nil),
+		"FIT1008": requisiteUnit("FIT1008", UnitNode("FIT1045")),
+		"FIT2004": requisiteUnit("FIT2004", UnitNode("FIT1008")),
+		// Gated only by credit points, so no unit lists it in its unlocks
+		"FIT2099": requisiteUnit("FIT2099", CreditPointNode(CreditPointConstraint{Kind: CreditPointsPassed, Amount: 12})),
+		"FIT3171": requisiteUnit("FIT3171", CreditPointNode(CreditPointConstraint{Kind: CreditPointsPassed, Amount: 24})),
+	}
+	for code, unit := range BuildReverseIndex(map[string]*RefinedRequisite{
+		"FIT1008": units["FIT1008"].Requisites,
+		"FIT2004": units["FIT2004"].Requisites,
+	}) {
+		units[code].Unlocks = unit.Unlocks
+	}
+
+	tests := []struct {
+		name       string
+		completed  []string
+		direct     []string
+		transitive []string
+	}{
+		{"nothing completed", nil, []string{}, []string{}},
+		{"one unit", []string{"FIT1045"}, []string{"FIT1008"}, []string{"FIT2004", "FIT2099", "FIT3171"}},
+		{"threshold reached after several rounds", []string{"FIT1045", "FIT1008"}, []string{"FIT2004", "FIT2099"}, []string{"FIT3171"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := Unlocked(units, test.completed, "")
+			if !reflect.DeepEqual(report.Direct, test.direct) || !reflect.DeepEqual(report.Transitive, test.transitive) {
+				t.Errorf("direct %v, transitive %v, want %v, %v", report.Direct, report.Transitive, test.direct, test.transitive)
+			}
+		})
+	}
+}
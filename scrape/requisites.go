@@ -4,17 +4,21 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"handbook-scraper/config"
 	"io"
 	"net/http"
-	"os"
 	"sync"
+	"sync/atomic"
 )
 
-// Processes the requisites
-func RequisiteScrape(unitCodeList [][]string, fileName string, year int) {
-	numWorkers := 10
+// FetchRequisites asks MonPlan about each group of units, planned together in one semester of year.
+// Requests that fail are counted and reported through an ErrIncomplete error
+// alongside the successful responses.
+func FetchRequisites(settings *config.Config, unitCodeList [][]string, year int) ([]map[string]interface{}, error) {
+	numWorkers := settings.Workers
 
 	var wg sync.WaitGroup
+	var failed atomic.Int64
 	results := make(chan map[string]interface{}, len(unitCodeList))
 
 	for idx := 0; idx < numWorkers; idx++ {
@@ -25,9 +29,10 @@ func RequisiteScrape(unitCodeList [][]string, fileName string, year int) {
 		go func(unitCodesSlice [][]string) {
 			defer wg.Done()
 			for _, unitCode := range unitCodesSlice {
-				response, err := postRequest(unitCode, year)
+				response, err := PostPlan(settings.MonPlanURL, createRequestPayload(unitCode, year))
 				if err != nil {
 					fmt.Printf("Error for unit %s: %v\n", unitCode, err)
+					failed.Add(1)
 				} else {
 					results <- response
 				}
@@ -40,20 +45,20 @@ func RequisiteScrape(unitCodeList [][]string, fileName string, year int) {
 		close(results)
 	}()
 
-	var responses []map[string]interface{}
+	responses := make([]map[string]interface{}, 0, len(unitCodeList))
 
 	for response := range results {
 		responses = append(responses, response)
 	}
 
-	// refactor to save separately, have filter on top, have this return the responses instead
-	saveResponsesToJSON(responses, fileName)
+	if count := failed.Load(); count > 0 {
+		return responses, fmt.Errorf("%d of %d MonPlan requests failed: %w", count, len(unitCodeList), ErrIncomplete)
+	}
+	return responses, nil
 }
 
-func postRequest(unitCodes []string, year int) (map[string]interface{}, error) {
-	url := "https://mscv.apps.monash.edu"
-	payload := createRequestPayload(unitCodes, year)
-
+// PostPlan sends a plan payload to the MonPlan endpoint at url and returns its decoded response.
+func PostPlan(url string, payload map[string]interface{}) (map[string]interface{}, error) {
 	requestBody, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
@@ -65,6 +70,10 @@ func postRequest(unitCodes []string, year int) (map[string]interface{}, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("MonPlan returned %s", resp.Status)
+	}
+
 	// Read the response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -79,7 +88,14 @@ func postRequest(unitCodes []string, year int) (map[string]interface{}, error) {
 	return response, nil
 }
 
-func createRequestPayload(unitCodes []string, year int) map[string]interface{} {
+// TeachingPeriod is one period of a MonPlan plan, e.g. year 2024, code "S1-01".
+type TeachingPeriod struct {
+	Year  int
+	Code  string
+	Units []string
+}
+
+func planUnits(unitCodes []string) []map[string]interface{} {
 	units := make([]map[string]interface{}, len(unitCodes))
 
 	for i, unitCode := range unitCodes {
@@ -89,36 +105,45 @@ func createRequestPayload(unitCodes []string, year int) map[string]interface{} {
 		}
 		units[i] = unit
 	}
+	return units
+}
+
+// CreatePlanPayload builds the MonPlan request for a whole plan.
+// Advanced standing units are sent in the same shape as planned units.
+// The course is left out of courseInfo when empty.
+func CreatePlanPayload(startYear int, course string, periods []TeachingPeriod, advancedStanding []string) map[string]interface{} {
+	teachingPeriods := make([]map[string]interface{}, len(periods))
+	for i, period := range periods {
+		teachingPeriods[i] = map[string]interface{}{
+			"year":         period.Year,
+			"code":         period.Code,
+			"units":        planUnits(period.Units),
+			"intermission": false,
+			"studyAbroad":  false,
+		}
+	}
+
+	standing := make([]interface{}, 0, len(advancedStanding))
+	for _, unit := range planUnits(advancedStanding) {
+		standing = append(standing, unit)
+	}
+
+	courseInfo := map[string]interface{}{}
+	if course != "" {
+		courseInfo["courseCode"] = course
+	}
 
 	payload := map[string]interface{}{
-		"startYear":            year,
-		"advancedStanding":     []interface{}{},
+		"startYear":            startYear,
+		"advancedStanding":     standing,
 		"internationalStudent": false,
-		"courseInfo":           map[string]interface{}{},
-		"teachingPeriods": []map[string]interface{}{
-			{
-				"year":         year,
-				"code":         "S1-01",
-				"units":        units,
-				"intermission": false,
-				"studyAbroad":  false,
-			},
-		},
+		"courseInfo":           courseInfo,
+		"teachingPeriods":      teachingPeriods,
 	}
 
 	return payload
 }
 
-func saveResponsesToJSON(responses []map[string]interface{}, fileName string) {
-	file, err := os.Create("data/raw_" + fileName + ".json")
-	if err != nil {
-		fmt.Printf("Error creating JSON file: %v\n", err)
-		return
-	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(responses); err != nil {
-		fmt.Printf("Error encoding JSON: %v\n", err)
-	}
+func createRequestPayload(unitCodes []string, year int) map[string]interface{} {
+	return CreatePlanPayload(year, "", []TeachingPeriod{{Year: year, Code: "S1-01", Units: unitCodes}}, nil)
 }
@@ -0,0 +1,452 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SQLiteFile is the database the sqlite backend keeps in the data directory.
+const SQLiteFile = "handbook.db"
+
+// Every artefact has a row in artefacts. Collections put one row per record in records,
+// so a unit can be queried without decoding the rest, e.g.
+//
+//	SELECT json_extract(data, '$.title') FROM records WHERE key = 'formatted_units' AND code = 'FIT1045'
+//
+// and everything else is one JSON document in snapshots.
+const schema = `
+CREATE TABLE IF NOT EXISTS artefacts (
+	key      TEXT PRIMARY KEY,
+	modified INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS records (
+	key      TEXT NOT NULL REFERENCES artefacts (key) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	code     TEXT NOT NULL,
+	data     TEXT NOT NULL,
+	PRIMARY KEY (key, position)
+);
+CREATE INDEX IF NOT EXISTS records_by_code ON records (key, code);
+CREATE TABLE IF NOT EXISTS snapshots (
+	key  TEXT PRIMARY KEY REFERENCES artefacts (key) ON DELETE CASCADE,
+	data TEXT NOT NULL
+);
+`
+
+// SQLiteStore keeps the artefacts in one SQLite database.
+type SQLiteStore struct {
+	db   *sql.DB
+	path string
+}
+
+// record is one row of a collection.
+type record struct {
+	code  string
+	value interface{}
+}
+
+// ErrNoCgo is returned by OpenSQLite in builds without cgo, which the SQLite driver needs.
+var ErrNoCgo = errors.New("the sqlite backend needs a build with cgo (CGO_ENABLED=1 and a C compiler); rebuild with cgo or use the files backend")
+
+// OpenSQLite opens the database at path, creating it and its tables if needed.
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	if !sqliteDriver {
+		return nil, fmt.Errorf("opening %s: %w", path, ErrNoCgo)
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=on")
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	// The pipeline writes from several stages at once and SQLite has a single writer
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating tables in %s: %w", path, err)
+	}
+	return &SQLiteStore{db: db, path: path}, nil
+}
+
+// write runs fn in a transaction that marks key as modified.
+// With replace, whatever key held before is removed first.
+func (store *SQLiteStore) write(key Key, replace bool, fn func(tx *sql.Tx) error) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return fmt.Errorf("writing %s to %s: %w", key, store.path, err)
+	}
+	defer tx.Rollback()
+
+	if err := touch(tx, key, replace); err != nil {
+		return fmt.Errorf("writing %s to %s: %w", key, store.path, err)
+	}
+	if err := fn(tx); err != nil {
+		return fmt.Errorf("writing %s to %s: %w", key, store.path, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("writing %s to %s: %w", key, store.path, err)
+	}
+	return nil
+}
+
+// touch marks key as modified, first removing what it held with replace.
+func touch(tx *sql.Tx, key Key, replace bool) error {
+	if replace {
+		if _, err := tx.Exec(`DELETE FROM artefacts WHERE key = ?`, string(key)); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`INSERT INTO artefacts (key, modified) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET modified = excluded.modified`, string(key), time.Now().UnixNano())
+	return err
+}
+
+// insertRecords adds records to a collection after the ones it already has.
+func insertRecords(tx *sql.Tx, key Key, records []record) error {
+	var next int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(position) + 1, 0) FROM records WHERE key = ?`, string(key)).Scan(&next); err != nil {
+		return err
+	}
+	insert, err := tx.Prepare(`INSERT INTO records (key, position, code, data) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	for idx, item := range records {
+		data, err := json.Marshal(item.value)
+		if err != nil {
+			return fmt.Errorf("encoding record %s: %w", item.code, err)
+		}
+		if _, err := insert.Exec(string(key), next+idx, item.code, string(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exists reports whether key was ever written, so an empty collection is told apart from a missing one.
+func (store *SQLiteStore) exists(key Key) error {
+	var found int
+	err := store.db.QueryRow(`SELECT 1 FROM artefacts WHERE key = ?`, string(key)).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("reading %s from %s: %w", key, store.path, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("reading %s from %s: %w", key, store.path, err)
+	}
+	return nil
+}
+
+// readRecords calls fn with each record of a collection in the order it was written.
+func (store *SQLiteStore) readRecords(key Key, fn func(code string, data []byte) error) error {
+	if err := store.exists(key); err != nil {
+		return err
+	}
+	rows, err := store.db.Query(`SELECT code, data FROM records WHERE key = ? ORDER BY position`, string(key))
+	if err != nil {
+		return fmt.Errorf("reading %s from %s: %w", key, store.path, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code string
+		var data []byte
+		if err := rows.Scan(&code, &data); err != nil {
+			return fmt.Errorf("reading %s from %s: %w", key, store.path, err)
+		}
+		if err := fn(code, data); err != nil {
+			return fmt.Errorf("decoding %s record %s: %w", key, code, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading %s from %s: %w", key, store.path, err)
+	}
+	return nil
+}
+
+func (store *SQLiteStore) getList(key Key) ([]map[string]interface{}, error) {
+	records := make([]map[string]interface{}, 0)
+	err := store.readRecords(key, func(code string, data []byte) error {
+		var value map[string]interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		records = append(records, value)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// listRecords keys each record of a list by its "code" field, when it has one.
+func listRecords(values []map[string]interface{}) []record {
+	records := make([]record, 0, len(values))
+	for _, value := range values {
+		code, _ := value["code"].(string)
+		records = append(records, record{code: code, value: value})
+	}
+	return records
+}
+
+func (store *SQLiteStore) GetRaw(content string) ([]map[string]interface{}, error) {
+	return store.getList(Raw(content))
+}
+
+func (store *SQLiteStore) PutRaw(content string, records []map[string]interface{}) error {
+	return store.write(Raw(content), true, func(tx *sql.Tx) error {
+		return insertRecords(tx, Raw(content), listRecords(records))
+	})
+}
+
+// AppendRaw only inserts the new pages.
+func (store *SQLiteStore) AppendRaw(content string, records []map[string]interface{}) error {
+	return store.write(Raw(content), false, func(tx *sql.Tx) error {
+		return insertRecords(tx, Raw(content), listRecords(records))
+	})
+}
+
+func (store *SQLiteStore) GetFormatted(content string) (map[string]interface{}, error) {
+	return store.getKeyed(Formatted(content))
+}
+
+// keyedRecords orders a collection keyed by code.
+func keyedRecords(values map[string]interface{}) []record {
+	codes := make([]string, 0, len(values))
+	for code := range values {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	records := make([]record, 0, len(codes))
+	for _, code := range codes {
+		records = append(records, record{code: code, value: values[code]})
+	}
+	return records
+}
+
+// getKeyed decodes a collection keyed by code.
+func (store *SQLiteStore) getKeyed(key Key) (map[string]interface{}, error) {
+	records := make(map[string]interface{})
+	err := store.readRecords(key, func(code string, data []byte) error {
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		records[code] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (store *SQLiteStore) PutFormatted(content string, records map[string]interface{}) error {
+	return store.write(Formatted(content), true, func(tx *sql.Tx) error {
+		return insertRecords(tx, Formatted(content), keyedRecords(records))
+	})
+}
+
+func (store *SQLiteStore) GetProcessed() (map[string]json.RawMessage, error) {
+	units := make(map[string]json.RawMessage)
+	err := store.readRecords(ProcessedUnits, func(code string, data []byte) error {
+		units[code] = json.RawMessage(data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return units, nil
+}
+
+func (store *SQLiteStore) PutProcessed(units map[string]interface{}) error {
+	return store.write(ProcessedUnits, true, func(tx *sql.Tx) error {
+		return insertRecords(tx, ProcessedUnits, keyedRecords(units))
+	})
+}
+
+// The catalog's sections are kept as collections of their own, e.g. catalog_units,
+// and its validation as the catalog_validation snapshot.
+const (
+	catalogUnits      Key = "catalog_units"
+	catalogCourses    Key = "catalog_courses"
+	catalogAOS        Key = "catalog_aos"
+	catalogValidation Key = "catalog_validation"
+)
+
+func (store *SQLiteStore) GetCatalog() (*CatalogContents, error) {
+	if err := store.exists(Catalog); err != nil {
+		return nil, err
+	}
+	var catalog CatalogContents
+	var err error
+	if catalog.Units, err = store.getKeyed(catalogUnits); err != nil {
+		return nil, err
+	}
+	if catalog.Courses, err = store.getKeyed(catalogCourses); err != nil {
+		return nil, err
+	}
+	if catalog.AOS, err = store.getKeyed(catalogAOS); err != nil {
+		return nil, err
+	}
+	if err := store.Get(catalogValidation, &catalog.Validation); err != nil {
+		return nil, err
+	}
+	return &catalog, nil
+}
+
+func (store *SQLiteStore) PutCatalog(catalog *CatalogContents) error {
+	validation, err := json.Marshal(catalog.Validation)
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", catalogValidation, err)
+	}
+	return store.write(Catalog, true, func(tx *sql.Tx) error {
+		sections := map[Key]map[string]interface{}{
+			catalogUnits:   catalog.Units,
+			catalogCourses: catalog.Courses,
+			catalogAOS:     catalog.AOS,
+		}
+		for key, records := range sections {
+			if err := touch(tx, key, true); err != nil {
+				return err
+			}
+			if err := insertRecords(tx, key, keyedRecords(records)); err != nil {
+				return err
+			}
+		}
+		if err := touch(tx, catalogValidation, true); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO snapshots (key, data) VALUES (?, ?)`, string(catalogValidation), string(validation))
+		return err
+	})
+}
+
+// Requisites are kept under the same raw_<probe> key as the file layout.
+func (store *SQLiteStore) GetRequisites(probe string) ([]map[string]interface{}, error) {
+	return store.getList(Raw(probe))
+}
+
+func (store *SQLiteStore) PutRequisites(probe string, responses []map[string]interface{}) error {
+	return store.write(Raw(probe), true, func(tx *sql.Tx) error {
+		return insertRecords(tx, Raw(probe), listRecords(responses))
+	})
+}
+
+// collection reports whether key is kept as records rather than a snapshot,
+// and whether its records are keyed by code rather than listed.
+func collection(key Key) (isCollection, keyed bool) {
+	switch {
+	case key == Catalog, key == ProcessedUnits, key == catalogUnits, key == catalogCourses, key == catalogAOS:
+		return true, true
+	case strings.HasPrefix(string(key), "formatted_"):
+		return true, true
+	case strings.HasPrefix(string(key), "raw_"):
+		return true, false
+	}
+	return false, false
+}
+
+// document reads a collection back as the one JSON document the files backend keeps for it.
+func (store *SQLiteStore) document(key Key) ([]byte, error) {
+	if key == Catalog {
+		catalog, err := store.GetCatalog()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(catalog)
+	}
+	if _, keyed := collection(key); keyed {
+		records := make(map[string]json.RawMessage)
+		err := store.readRecords(key, func(code string, data []byte) error {
+			records[code] = json.RawMessage(data)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(records)
+	}
+	records := make([]json.RawMessage, 0)
+	err := store.readRecords(key, func(code string, data []byte) error {
+		records = append(records, json.RawMessage(data))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(records)
+}
+
+// Get also reads collections, assembled into the document the files backend would hold.
+func (store *SQLiteStore) Get(key Key, value interface{}) error {
+	var data []byte
+	var err error
+	if isCollection, _ := collection(key); isCollection {
+		data, err = store.document(key)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = store.db.QueryRow(`SELECT data FROM snapshots WHERE key = ?`, string(key)).Scan(&data)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("reading %s from %s: %w", key, store.path, ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s from %s: %w", key, store.path, err)
+		}
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("decoding %s: %w", key, err)
+	}
+	return nil
+}
+
+// Put only writes snapshots; collections go through their own setters so they are kept as records.
+func (store *SQLiteStore) Put(key Key, value interface{}) error {
+	if isCollection, _ := collection(key); isCollection {
+		return fmt.Errorf("writing %s to %s: not a snapshot, it is kept as records", key, store.path)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", key, err)
+	}
+	return store.write(key, true, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO snapshots (key, data) VALUES (?, ?)`, string(key), string(data))
+		return err
+	})
+}
+
+func (store *SQLiteStore) Delete(key Key) error {
+	keys := []interface{}{string(key)}
+	if key == Catalog {
+		keys = append(keys, string(catalogUnits), string(catalogCourses), string(catalogAOS), string(catalogValidation))
+	}
+	query := `DELETE FROM artefacts WHERE key IN (?` + strings.Repeat(`, ?`, len(keys)-1) + `)`
+	if _, err := store.db.Exec(query, keys...); err != nil {
+		return fmt.Errorf("removing %s from %s: %w", key, store.path, err)
+	}
+	return nil
+}
+
+func (store *SQLiteStore) Modified(key Key) (time.Time, error) {
+	var modified int64
+	err := store.db.QueryRow(`SELECT modified FROM artefacts WHERE key = ?`, string(key)).Scan(&modified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, fmt.Errorf("%s in %s: %w", key, store.path, ErrNotFound)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s in %s: %w", key, store.path, err)
+	}
+	return time.Unix(0, modified), nil
+}
+
+func (store *SQLiteStore) Close() error {
+	return store.db.Close()
+}
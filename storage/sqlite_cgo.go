@@ -0,0 +1,8 @@
+//go:build cgo
+
+package storage
+
+import _ "github.com/mattn/go-sqlite3"
+
+// sqliteDriver is registered by go-sqlite3, which needs cgo.
+const sqliteDriver = true
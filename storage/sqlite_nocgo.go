@@ -0,0 +1,6 @@
+//go:build !cgo
+
+package storage
+
+// Without cgo go-sqlite3 only registers a stub, so OpenSQLite refuses to open the database.
+const sqliteDriver = false
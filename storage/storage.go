@@ -0,0 +1,267 @@
+// Persists the pipeline's artefacts. Library stages take and return values; the CLI
+// moves them in and out of a Store, either one JSON file per artefact or an SQLite database.
+
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Key names one artefact of the pipeline, e.g. "raw_units" or "formatted_courses".
+type Key string
+
+// Scrape artefacts
+const (
+	ContentSplits Key = "content_splits"
+)
+
+// Raw is the scraped handbook content (units, courses, aos) or MonPlan responses (prerequisites, prohibitions).
+// Both are kept as records, through GetRaw and GetRequisites.
+func Raw(content string) Key { return Key("raw_" + content) }
+
+// Failed lists the items of a handbook scrape still to be retried.
+func Failed(content string) Key { return Key(content + "_failed") }
+
+// Format artefacts
+const (
+	DetectedYear               Key = "detected_year"
+	ProhibitionCandidates      Key = "prohibition_candidates"
+	EquivalentUnitGroups       Key = "equivalent_unit_groups"
+	UnknownCodesUnits          Key = "unknown_codes_units"
+	UnclassifiedEnrolmentRules Key = "unclassified_enrolment_rules"
+	MalformedUnits             Key = "malformed_units"
+)
+
+// Formatted is formatted content, kept as records through GetFormatted.
+func Formatted(content string) Key { return Key("formatted_" + content) }
+
+func RequirementIssues(content string) Key { return Key("requirement_issues_" + content) }
+
+// Process artefacts
+const (
+	ProcessedUnits          Key = "processed_units"
+	UnrecognisedRequisites  Key = "unrecognised_requisites"
+	UnknownCodesRequisites  Key = "unknown_codes_requisites"
+	RequisiteReconciliation Key = "requisite_reconciliation"
+	GraphAnalysis           Key = "graph_analysis"
+	Catalog                 Key = "catalog"
+)
+
+// RunState records the stages the last run failed in.
+const RunState Key = "run_state"
+
+// CatalogContents is the cross-referenced catalog: the processed units, courses and areas of study
+// by code, and the validation of the references between them.
+type CatalogContents struct {
+	Units      map[string]interface{} `json:"units"`
+	Courses    map[string]interface{} `json:"courses"`
+	AOS        map[string]interface{} `json:"aos"`
+	Validation interface{}            `json:"validation"`
+}
+
+// ErrNotFound is returned, wrapped, for artefacts that were never stored.
+var ErrNotFound = errors.New("not stored")
+
+// Store keeps the pipeline's artefacts. Raw records, formatted records, requisites, processed
+// units and the catalog are collections of records, so a backend can store them one record at
+// a time; everything else is a snapshot kept whole.
+type Store interface {
+	// GetRaw returns the scraped handbook pages of one kind of content (units, courses, aos).
+	GetRaw(content string) ([]map[string]interface{}, error)
+	// PutRaw replaces the scraped pages of one kind of content.
+	PutRaw(content string, records []map[string]interface{}) error
+	// AppendRaw adds pages to those already scraped, as a continued scrape does.
+	AppendRaw(content string, records []map[string]interface{}) error
+
+	// GetFormatted returns the formatted records of one kind of content by code.
+	GetFormatted(content string) (map[string]interface{}, error)
+	// PutFormatted replaces the formatted records of one kind of content.
+	PutFormatted(content string, records map[string]interface{}) error
+
+	// GetRequisites returns the MonPlan responses of one probe (prerequisites, prohibitions).
+	GetRequisites(probe string) ([]map[string]interface{}, error)
+	// PutRequisites replaces the MonPlan responses of one probe.
+	PutRequisites(probe string, responses []map[string]interface{}) error
+
+	// GetProcessed returns the processed units by code, still encoded so they can be decoded into typed records.
+	GetProcessed() (map[string]json.RawMessage, error)
+	// PutProcessed replaces the processed units.
+	PutProcessed(units map[string]interface{}) error
+
+	// GetCatalog returns the cross-referenced catalog.
+	GetCatalog() (*CatalogContents, error)
+	// PutCatalog replaces the catalog.
+	PutCatalog(catalog *CatalogContents) error
+
+	// Get decodes a snapshot into value. A collection is decoded as the one document
+	// the files backend keeps for it.
+	Get(key Key, value interface{}) error
+	// Put replaces a snapshot. Collections are written through their own methods.
+	Put(key Key, value interface{}) error
+
+	// Delete removes any artefact; deleting a missing one is not an error.
+	Delete(key Key) error
+	// Modified is when any artefact was last written.
+	Modified(key Key) (time.Time, error)
+	Close() error
+}
+
+// Open opens the store of a backend, "files" or "sqlite", in dir, creating dir and any missing parents.
+func Open(backend string, dir string) (Store, error) {
+	switch backend {
+	case "files":
+		return NewFileStore(dir)
+	case "sqlite":
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("creating data directory %s: %w", dir, err)
+		}
+		return OpenSQLite(filepath.Join(dir, SQLiteFile))
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// FileStore keeps each artefact as <key>.json in one directory, the layout the pipeline
+// has always written under ./data.
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore opens dir as a store, creating it and any missing parents.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating data directory %s: %w", dir, err)
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+// Path is the file an artefact is kept in.
+func (store *FileStore) Path(key Key) string {
+	return filepath.Join(store.Dir, string(key)+".json")
+}
+
+func (store *FileStore) GetRaw(content string) ([]map[string]interface{}, error) {
+	records := make([]map[string]interface{}, 0)
+	if err := store.Get(Raw(content), &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (store *FileStore) PutRaw(content string, records []map[string]interface{}) error {
+	return store.Put(Raw(content), records)
+}
+
+// AppendRaw rewrites the whole file, which is what the file layout allows.
+func (store *FileStore) AppendRaw(content string, records []map[string]interface{}) error {
+	existing, err := store.GetRaw(content)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return store.PutRaw(content, append(existing, records...))
+}
+
+func (store *FileStore) GetFormatted(content string) (map[string]interface{}, error) {
+	records := make(map[string]interface{})
+	if err := store.Get(Formatted(content), &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (store *FileStore) PutFormatted(content string, records map[string]interface{}) error {
+	return store.Put(Formatted(content), records)
+}
+
+// Requisites are kept as raw_<probe>.json.
+func (store *FileStore) GetRequisites(probe string) ([]map[string]interface{}, error) {
+	responses := make([]map[string]interface{}, 0)
+	if err := store.Get(Raw(probe), &responses); err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
+
+func (store *FileStore) PutRequisites(probe string, responses []map[string]interface{}) error {
+	return store.Put(Raw(probe), responses)
+}
+
+func (store *FileStore) GetProcessed() (map[string]json.RawMessage, error) {
+	units := make(map[string]json.RawMessage)
+	if err := store.Get(ProcessedUnits, &units); err != nil {
+		return nil, err
+	}
+	return units, nil
+}
+
+func (store *FileStore) PutProcessed(units map[string]interface{}) error {
+	return store.Put(ProcessedUnits, units)
+}
+
+func (store *FileStore) GetCatalog() (*CatalogContents, error) {
+	var catalog CatalogContents
+	if err := store.Get(Catalog, &catalog); err != nil {
+		return nil, err
+	}
+	return &catalog, nil
+}
+
+func (store *FileStore) PutCatalog(catalog *CatalogContents) error {
+	return store.Put(Catalog, catalog)
+}
+
+func (store *FileStore) Get(key Key, value interface{}) error {
+	path := store.Path(key)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("reading %s: %w", path, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return nil
+}
+
+func (store *FileStore) Put(key Key, value interface{}) error {
+	path := store.Path(key)
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+func (store *FileStore) Delete(key Key) error {
+	path := store.Path(key)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing %s: %w", path, err)
+	}
+	return nil
+}
+
+func (store *FileStore) Modified(key Key) (time.Time, error) {
+	path := store.Path(key)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return time.Time{}, fmt.Errorf("%s: %w", path, ErrNotFound)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+func (store *FileStore) Close() error {
+	return nil
+}
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// backends opens an empty store of each backend. SQLite is skipped in builds without cgo.
+func backends(t *testing.T) map[string]Store {
+	stores := make(map[string]Store)
+
+	files, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores["files"] = files
+
+	sqlite, err := OpenSQLite(filepath.Join(t.TempDir(), SQLiteFile))
+	switch {
+	case errors.Is(err, ErrNoCgo):
+		t.Log("skipping sqlite: ", err)
+	case err != nil:
+		t.Fatal(err)
+	default:
+		stores["sqlite"] = sqlite
+	}
+
+	t.Cleanup(func() {
+		for _, store := range stores {
+			store.Close()
+		}
+	})
+	return stores
+}
+
+// forEachBackend runs test against a fresh store of every backend.
+func forEachBackend(t *testing.T, test func(t *testing.T, store Store)) {
+	for name, store := range backends(t) {
+		t.Run(name, func(t *testing.T) { test(t, store) })
+	}
+}
+
+// getDocument reads any artefact through Get as plain JSON values.
+func getDocument(t *testing.T, store Store, key Key) interface{} {
+	t.Helper()
+	var document interface{}
+	if err := store.Get(key, &document); err != nil {
+		t.Fatalf("Get(%s): %v", key, err)
+	}
+	return document
+}
+
+func TestRawRecords(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		first := []map[string]interface{}{{"code": "FIT1045", "title": "Introduction to programming"}}
+		second := []map[string]interface{}{{"code": "FIT1008", "title": "Fundamentals of algorithms"}}
+		if err := store.PutRaw("units", first); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AppendRaw("units", second); err != nil {
+			t.Fatal(err)
+		}
+
+		want := append(append([]map[string]interface{}{}, first...), second...)
+		got, err := store.GetRaw("units")
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("GetRaw = %v, %v, want %v", got, err, want)
+		}
+
+		document := getDocument(t, store, Raw("units"))
+		if records, ok := document.([]interface{}); !ok || len(records) != 2 {
+			t.Errorf("Get(raw_units) = %v, want the two records as a list", document)
+		}
+
+		// Putting again replaces rather than appends
+		if err := store.PutRaw("units", second); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := store.GetRaw("units"); !reflect.DeepEqual(got, second) {
+			t.Errorf("after PutRaw, GetRaw = %v, want %v", got, second)
+		}
+	})
+}
+
+func TestFormattedAndProcessedRecords(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		units := map[string]interface{}{
+			"FIT1045": map[string]interface{}{"code": "FIT1045", "level": float64(1)},
+			"FIT2004": map[string]interface{}{"code": "FIT2004", "level": float64(2)},
+		}
+
+		if err := store.PutFormatted("units", units); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := store.GetFormatted("units"); err != nil || !reflect.DeepEqual(got, units) {
+			t.Errorf("GetFormatted = %v, %v, want %v", got, err, units)
+		}
+		if got := getDocument(t, store, Formatted("units")); !reflect.DeepEqual(got, map[string]interface{}(units)) {
+			t.Errorf("Get(formatted_units) = %v, want %v", got, units)
+		}
+
+		if err := store.PutProcessed(units); err != nil {
+			t.Fatal(err)
+		}
+		processed, err := store.GetProcessed()
+		if err != nil || len(processed) != 2 {
+			t.Fatalf("GetProcessed = %v, %v, want two units", processed, err)
+		}
+		var unit map[string]interface{}
+		if err := json.Unmarshal(processed["FIT2004"], &unit); err != nil || unit["level"] != float64(2) {
+			t.Errorf("processed FIT2004 = %v, %v", unit, err)
+		}
+		if got := getDocument(t, store, ProcessedUnits); !reflect.DeepEqual(got, map[string]interface{}(units)) {
+			t.Errorf("Get(processed_units) = %v, want %v", got, units)
+		}
+	})
+}
+
+func TestRequisites(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		responses := []map[string]interface{}{{"unit": "FIT2004", "errors": []interface{}{"Prohibited unit"}}}
+		if err := store.PutRequisites("prerequisites", responses); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := store.GetRequisites("prerequisites"); err != nil || !reflect.DeepEqual(got, responses) {
+			t.Errorf("GetRequisites = %v, %v, want %v", got, err, responses)
+		}
+		if _, err := store.GetRequisites("prohibitions"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetRequisites of an unstored probe: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestCatalog(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		catalog := &CatalogContents{
+			Units:      map[string]interface{}{"FIT1045": map[string]interface{}{"code": "FIT1045"}},
+			Courses:    map[string]interface{}{"C2001": map[string]interface{}{"code": "C2001"}},
+			AOS:        map[string]interface{}{},
+			Validation: map[string]interface{}{"missing_units": []interface{}{}},
+		}
+		if err := store.PutCatalog(catalog); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.GetCatalog()
+		if err != nil || !reflect.DeepEqual(got, catalog) {
+			t.Errorf("GetCatalog = %+v, %v, want %+v", got, err, catalog)
+		}
+
+		var document CatalogContents
+		if err := store.Get(Catalog, &document); err != nil || !reflect.DeepEqual(&document, catalog) {
+			t.Errorf("Get(catalog) = %+v, %v, want %+v", document, err, catalog)
+		}
+	})
+}
+
+func TestSnapshots(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		if _, err := store.Modified(DetectedYear); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Modified before writing: err = %v, want ErrNotFound", err)
+		}
+		var year int
+		if err := store.Get(DetectedYear, &year); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get before writing: err = %v, want ErrNotFound", err)
+		}
+
+		if err := store.Put(DetectedYear, 2024); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Get(DetectedYear, &year); err != nil || year != 2024 {
+			t.Errorf("Get = %d, %v, want 2024", year, err)
+		}
+		if _, err := store.Modified(DetectedYear); err != nil {
+			t.Errorf("Modified after writing: %v", err)
+		}
+
+		if err := store.Delete(DetectedYear); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Get(DetectedYear, &year); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+		}
+		if err := store.Delete(DetectedYear); err != nil {
+			t.Errorf("deleting a missing artefact: %v", err)
+		}
+	})
+}
+
+// The pipeline keeps the stages that failed under RunState and deletes it after a clean run.
+func TestRunState(t *testing.T) {
+	type state struct {
+		Failed []string `json:"failed"`
+	}
+
+	forEachBackend(t, func(t *testing.T, store Store) {
+		saved := state{Failed: []string{"requisites", "scrape-units"}}
+		if err := store.Put(RunState, saved); err != nil {
+			t.Fatal(err)
+		}
+		var loaded state
+		if err := store.Get(RunState, &loaded); err != nil || !reflect.DeepEqual(loaded, saved) {
+			t.Errorf("Get(run_state) = %+v, %v, want %+v", loaded, err, saved)
+		}
+
+		if err := store.Delete(RunState); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Get(RunState, &loaded); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get after a clean run: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestSQLitePutRefusesCollections(t *testing.T) {
+	store, ok := backends(t)["sqlite"]
+	if !ok {
+		t.Skip("no sqlite driver in this build")
+	}
+	for _, key := range []Key{Raw("units"), Formatted("units"), ProcessedUnits, Catalog} {
+		if err := store.Put(key, map[string]interface{}{}); err == nil {
+			t.Errorf("Put(%s) should fail, it is kept as records", key)
+		}
+	}
+}